@@ -0,0 +1,355 @@
+package rtp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	defaultBatchSize = 32
+
+	// maxGSOSegments is the kernel limit of segments per UDP_SEGMENT send
+	maxGSOSegments = 64
+	maxGSOSize     = 65000
+	maxGROSize     = 65535
+)
+
+// BatchReadWriter is implemented by transports able to move several packets
+// per call, Conn reads and writes through it when available.
+type BatchReadWriter interface {
+	// ReadBatch reads up to len(bufs) packets, the size of bufs[i] is
+	// stored in sizes[i]
+	ReadBatch(bufs [][]byte, sizes []int) (int, error)
+
+	// WriteBatch writes the packets of bufs in order and returns the
+	// number of packets written
+	WriteBatch(bufs [][]byte) (int, error)
+}
+
+// NewBatchConn wraps a UDP socket exchanging packets with raddr, raddr is nil
+// for a connected socket. On Linux packets are moved with recvmmsg/sendmmsg
+// and coalesced with UDP GSO/GRO when the kernel supports it, elsewhere it
+// falls back to a packet per call.
+func NewBatchConn(c *net.UDPConn, raddr *net.UDPAddr) io.ReadWriteCloser {
+	b := newBatcher(c)
+	if b == nil {
+		return &fixedConn{UDPConn: c, raddr: raddr}
+	}
+
+	return &batchConn{
+		fixedConn: &fixedConn{UDPConn: c, raddr: raddr},
+		b:         b,
+	}
+}
+
+// fixedConn is a UDP socket exchanging packets with a single peer
+type fixedConn struct {
+	*net.UDPConn
+	raddr *net.UDPAddr
+}
+
+func (fc *fixedConn) Write(data []byte) (int, error) {
+	if fc.raddr == nil {
+		return fc.UDPConn.Write(data)
+	}
+	return fc.WriteToUDP(data, fc.raddr)
+}
+
+func (fc *fixedConn) RemoteAddr() net.Addr {
+	if fc.raddr == nil {
+		return fc.UDPConn.RemoteAddr()
+	}
+	return fc.raddr
+}
+
+type batchConn struct {
+	*fixedConn
+	b *batcher
+}
+
+func (bc *batchConn) ReadBatch(bufs [][]byte, sizes []int) (int, error) {
+	n, err := bc.b.readBatch(bufs, sizes, nil)
+	return n, err
+}
+
+func (bc *batchConn) WriteBatch(bufs [][]byte) (int, error) {
+	var addr net.Addr
+	if bc.raddr != nil {
+		addr = bc.raddr
+	}
+	return bc.b.writeBatch(bufs, addr)
+}
+
+type batchPacketConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// batcher moves packet batches over a UDP socket
+type batcher struct {
+	pc batchPacketConn
+
+	rmutex   sync.Mutex
+	rmsgs    []ipv4.Message
+	rbufs    [][]byte
+	gro      bool
+	pending  [][]byte
+	pendAddr []net.Addr
+
+	wmutex sync.Mutex
+	wmsgs  []ipv4.Message
+	counts []int
+	gso    bool
+	oobs   [][]byte
+}
+
+func newBatcher(c *net.UDPConn) *batcher {
+	if !batchSupported {
+		return nil
+	}
+
+	b := &batcher{
+		rmsgs:  make([]ipv4.Message, defaultBatchSize),
+		rbufs:  make([][]byte, defaultBatchSize),
+		wmsgs:  make([]ipv4.Message, defaultBatchSize),
+		counts: make([]int, defaultBatchSize),
+		oobs:   make([][]byte, defaultBatchSize),
+	}
+
+	if addr, ok := c.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil && !addr.IP.IsUnspecified() {
+		b.pc = ipv6.NewPacketConn(c)
+	} else {
+		b.pc = ipv4.NewPacketConn(c)
+	}
+
+	b.gso, b.gro = enableOffload(c)
+
+	size := maxDatagramSize
+	if b.gro {
+		size = maxGROSize
+	}
+	for i := range b.rmsgs {
+		b.rbufs[i] = make([]byte, size)
+		b.rmsgs[i].Buffers = [][]byte{b.rbufs[i]}
+		b.rmsgs[i].OOB = make([]byte, offloadControlSize)
+	}
+	for i := range b.oobs {
+		b.oobs[i] = make([]byte, offloadControlSize)
+	}
+	return b
+}
+
+// readBatch reads packets into bufs, the source address of every packet is
+// stored in addrs if not nil. A packet larger than its buffer is dropped and
+// reported by io.ErrShortBuffer after the packets before it.
+func (b *batcher) readBatch(bufs [][]byte, sizes []int, addrs []net.Addr) (int, error) {
+	b.rmutex.Lock()
+	defer b.rmutex.Unlock()
+
+	if len(b.pending) == 0 {
+		if err := b.receive(len(bufs)); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for ; n < len(bufs) && len(b.pending) > 0; n++ {
+		if len(b.pending[0]) > len(bufs[n]) {
+			b.pending = b.pending[1:]
+			b.pendAddr = b.pendAddr[1:]
+			return n, io.ErrShortBuffer
+		}
+		sizes[n] = copy(bufs[n], b.pending[0])
+		if addrs != nil {
+			addrs[n] = b.pendAddr[0]
+		}
+		b.pending = b.pending[1:]
+		b.pendAddr = b.pendAddr[1:]
+	}
+	return n, nil
+}
+
+// receive fills pending with the packets of one recvmmsg, GRO coalesced
+// datagrams are split into their segments.
+func (b *batcher) receive(count int) error {
+	if count > len(b.rmsgs) {
+		count = len(b.rmsgs)
+	}
+
+	msgs := b.rmsgs[:count]
+	for i := range msgs {
+		msgs[i].OOB = msgs[i].OOB[:cap(msgs[i].OOB)]
+	}
+
+	n, err := b.pc.ReadBatch(msgs, 0)
+	if err != nil {
+		return err
+	}
+
+	b.pending = b.pending[:0]
+	b.pendAddr = b.pendAddr[:0]
+	for _, m := range msgs[:n] {
+		data := m.Buffers[0][:m.N]
+		size := len(data)
+		if b.gro {
+			if s := groSegmentSize(m.OOB[:m.NN]); s > 0 {
+				size = s
+			}
+		}
+
+		for len(data) > 0 {
+			end := size
+			if end > len(data) {
+				end = len(data)
+			}
+			b.pending = append(b.pending, data[:end])
+			b.pendAddr = append(b.pendAddr, m.Addr)
+			data = data[end:]
+		}
+	}
+	return nil
+}
+
+// writeBatch sends bufs to addr, runs of equally sized packets are sent as a
+// single GSO message when supported.
+func (b *batcher) writeBatch(bufs [][]byte, addr net.Addr) (int, error) {
+	b.wmutex.Lock()
+	defer b.wmutex.Unlock()
+
+	written := 0
+	for written < len(bufs) {
+		msgs := b.wmsgs[:0]
+		counts := b.counts[:0]
+		for i := written; i < len(bufs) && len(msgs) < cap(msgs); {
+			segments := 1
+			if b.gso {
+				segments = gsoRun(bufs[i:])
+			}
+
+			m := ipv4.Message{
+				Buffers: bufs[i : i+segments],
+				Addr:    addr,
+			}
+			if segments > 1 {
+				m.OOB = appendGSOControl(b.oobs[len(msgs)][:0], len(bufs[i]))
+			}
+			msgs = append(msgs, m)
+			counts = append(counts, segments)
+			i += segments
+		}
+
+		n, err := b.pc.WriteBatch(msgs, 0)
+		for _, c := range counts[:n] {
+			written += c
+		}
+
+		if err != nil {
+			if b.gso && gsoFailed(err) {
+				// kernel or NIC can not segment, retry packet by packet
+				b.gso = false
+				continue
+			}
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// gsoRun returns the number of leading packets of bufs that can be sent as
+// one GSO message: equally sized packets and optionally a shorter last one.
+func gsoRun(bufs [][]byte) int {
+	size := len(bufs[0])
+	total := size
+	n := 1
+	for n < len(bufs) && n < maxGSOSegments && total+len(bufs[n]) <= maxGSOSize {
+		l := len(bufs[n])
+		if l > size {
+			break
+		}
+		total += l
+		n += 1
+		if l < size {
+			break
+		}
+	}
+	return n
+}
+
+func (c *conn) readBatchPump(br BatchReadWriter) {
+	buffers := make([]*packetBuffer, defaultBatchSize)
+	bufs := make([][]byte, defaultBatchSize)
+	sizes := make([]int, defaultBatchSize)
+	for i := range bufs {
+		buffers[i] = newPacketBuffer()
+		bufs[i] = buffers[i].data
+	}
+
+	defer func() {
+		for _, b := range buffers {
+			b.release()
+		}
+	}()
+
+	for {
+		n, err := br.ReadBatch(bufs, sizes)
+		if errors.Is(err, io.ErrShortBuffer) {
+			c.dropOversized()
+		} else if err != nil && n == 0 {
+			c.fail(err)
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			b := buffers[i]
+			buffers[i] = newPacketBuffer()
+			bufs[i] = buffers[i].data
+			c.receive(b, sizes[i])
+		}
+	}
+}
+
+func (c *conn) writeBatchPump(ctx context.Context, bw BatchReadWriter) {
+	storage := make([][]byte, defaultBatchSize)
+	for i := range storage {
+		storage[i] = make([]byte, maxDatagramSize)
+	}
+
+	bufs := make([][]byte, 0, defaultBatchSize)
+	ssrcs := make([]uint32, defaultBatchSize)
+	for {
+		item, ok := c.writeQ.pop(ctx)
+		for bufs = bufs[:0]; ok; {
+			i := len(bufs)
+			var data []byte
+			ssrcs[i] = item.p.SSRC
+			data, storage[i] = marshalPacket(item.p, storage[i])
+			bufs = append(bufs, data)
+			if len(bufs) == cap(bufs) {
+				break
+			}
+			item, ok = c.writeQ.tryPop()
+		}
+		if len(bufs) == 0 {
+			return
+		}
+
+		for sent := 0; sent < len(bufs); {
+			n, err := bw.WriteBatch(bufs[sent:])
+			c.sent(n)
+			for i := sent; i < sent+n; i++ {
+				c.metrics.PacketSent(ssrcs[i], len(bufs[i]))
+			}
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			sent += n
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package rtp
+
+import (
+	"net"
+	"runtime"
+)
+
+// batch reads are single packet reads outside Linux and unsupported on Windows
+const batchSupported = runtime.GOOS != "windows"
+
+const offloadControlSize = 0
+
+func enableOffload(c *net.UDPConn) (gso, gro bool) {
+	return false, false
+}
+
+func appendGSOControl(oob []byte, size int) []byte {
+	return oob
+}
+
+func groSegmentSize(oob []byte) int {
+	return 0
+}
+
+func gsoFailed(err error) bool {
+	return false
+}
@@ -0,0 +1,123 @@
+package rtp
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/ipv4"
+)
+
+func TestBatchConn(t *testing.T) {
+	a, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	b, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+
+	sender := NewBatchConn(a, b.LocalAddr().(*net.UDPAddr))
+	receiver := NewBatchConn(b, a.LocalAddr().(*net.UDPAddr))
+	defer sender.Close()
+	defer receiver.Close()
+
+	bw, ok := sender.(BatchReadWriter)
+	if !ok {
+		t.Skip("batch I/O unsupported")
+	}
+
+	// equally sized packets and a shorter tail, the GSO friendly case
+	var packets [][]byte
+	for i := 0; i < 10; i++ {
+		size := 1200
+		if i == 9 {
+			size = 300
+		}
+		p := &Packet{Seq: uint16(i), SSRC: 1234, Payload: make([]byte, size-FixedHeaderSize)}
+		packets = append(packets, p.Encode())
+	}
+
+	n, err := bw.WriteBatch(packets)
+	assert.Nil(t, err)
+	assert.Equal(t, len(packets), n)
+
+	br := receiver.(BatchReadWriter)
+	bufs := make([][]byte, 4)
+	sizes := make([]int, 4)
+	for i := range bufs {
+		bufs[i] = make([]byte, maxDatagramSize)
+	}
+
+	var received []uint16
+	for len(received) < len(packets) {
+		n, err := br.ReadBatch(bufs, sizes)
+		assert.Nil(t, err)
+		for i := 0; i < n; i++ {
+			p := &Packet{}
+			assert.Equal(t, len(packets[len(received)]), p.Decode(bufs[i][:sizes[i]]))
+			received = append(received, p.Seq)
+		}
+	}
+	assert.Equal(t, []uint16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, received)
+}
+
+// groPacketConn serves datagrams read whole as by a GRO enabled socket
+type groPacketConn struct {
+	readCh chan []byte
+}
+
+func (gc *groPacketConn) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	data, ok := <-gc.readCh
+	if !ok {
+		return 0, io.EOF
+	}
+	ms[0].N = copy(ms[0].Buffers[0], data)
+	ms[0].NN = 0
+	return 1, nil
+}
+
+func (gc *groPacketConn) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	return len(ms), nil
+}
+
+// groConn is a Conn transport reading through a batcher
+type groConn struct {
+	*datagramConn
+	b *batcher
+}
+
+func (gc *groConn) ReadBatch(bufs [][]byte, sizes []int) (int, error) {
+	return gc.b.readBatch(bufs, sizes, nil)
+}
+
+func (gc *groConn) WriteBatch(bufs [][]byte) (int, error) {
+	return len(bufs), nil
+}
+
+func TestBatchOversized(t *testing.T) {
+	pc := &groPacketConn{readCh: make(chan []byte, 10)}
+	b := &batcher{
+		pc:    pc,
+		gro:   true,
+		rmsgs: make([]ipv4.Message, 1),
+	}
+	b.rmsgs[0].Buffers = [][]byte{make([]byte, maxGROSize)}
+	b.rmsgs[0].OOB = make([]byte, offloadControlSize)
+
+	c := NewConn(&groConn{datagramConn: newDatagramConn(), b: b}, 50*time.Millisecond)
+	defer c.Close()
+	defer close(pc.readCh)
+
+	// a datagram larger than a packet buffer without GRO segmentation
+	pc.readCh <- (&Packet{Seq: 1, Timestamp: 0, SSRC: 1234, Marker: 1, Payload: make([]byte, 2000)}).Encode()
+	pc.readCh <- (&Packet{Seq: 2, Timestamp: 3000, SSRC: 1234, Marker: 1, Payload: []byte{1, 2}}).Encode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	f, err := c.Stream(1234).ReadFrame(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3000), f.Timestamp())
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&c.(*conn).badPackets))
+}
@@ -0,0 +1,122 @@
+package rtp
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return allocPacketBuffer(maxDatagramSize)
+	},
+}
+
+// jumboBufferSize is the size class of the framed packets larger than a
+// datagram, larger packets get a buffer of their own
+const jumboBufferSize = 9000
+
+var jumboPool = sync.Pool{
+	New: func() any {
+		return allocPacketBuffer(jumboBufferSize)
+	},
+}
+
+func allocPacketBuffer(size int) *packetBuffer {
+	b := &packetBuffer{
+		data: make([]byte, size),
+	}
+	b.packet.buf = b
+	return b
+}
+
+// packetBuffer is a pooled receive buffer together with the packet decoded
+// from it. Payload, extension and CSRC of the packet alias the buffer, so it
+// goes back to the pool only when the last reference is released. Packets
+// sent by a Stream come from the same pool and are released once written.
+type packetBuffer struct {
+	packet Packet
+	ext    Extension
+	csrc   [15]uint32
+	data   []byte
+	refs   int32
+}
+
+// bufferReader is a packet transport handing over received packets in
+// pooled buffers, the reader owns the buffer returned
+type bufferReader interface {
+	readBuffer() (*packetBuffer, int, error)
+}
+
+func newPacketBuffer() *packetBuffer {
+	b := bufferPool.Get().(*packetBuffer)
+	b.refs = 1
+	return b
+}
+
+// newSizedBuffer returns a buffer of the smallest size class holding n
+// octets
+func newSizedBuffer(n int) *packetBuffer {
+	var b *packetBuffer
+	switch {
+	case n <= maxDatagramSize:
+		b = bufferPool.Get().(*packetBuffer)
+	case n <= jumboBufferSize:
+		b = jumboPool.Get().(*packetBuffer)
+	default:
+		b = allocPacketBuffer(n)
+	}
+	b.refs = 1
+	return b
+}
+
+// decode parses the first n bytes of the buffer into its packet
+func (b *packetBuffer) decode(n int, mode ParseMode) (*Packet, error) {
+	p := &b.packet
+	p.Extension = &b.ext
+	p.CSRC = b.csrc[:0]
+	err := p.Parse(b.data[:n], mode)
+	return p, err
+}
+
+func (b *packetBuffer) retain() {
+	atomic.AddInt32(&b.refs, 1)
+}
+
+func (b *packetBuffer) release() {
+	refs := atomic.AddInt32(&b.refs, -1)
+	if refs > 0 {
+		return
+	}
+
+	if refs < 0 {
+		panic("rtp: packet released more than retained")
+	}
+
+	b.packet = Packet{
+		buf: b,
+	}
+	b.ext = Extension{}
+	switch len(b.data) {
+	case maxDatagramSize:
+		bufferPool.Put(b)
+	case jumboBufferSize:
+		jumboPool.Put(b)
+	}
+}
+
+// Retain keeps the packet valid after its Frame is released, every Retain
+// must be paired with a Release.
+func (f *Packet) Retain() {
+	if f.buf != nil {
+		f.buf.retain()
+	}
+}
+
+// Release returns the receive buffer of the packet to the pool once no
+// reference is left, the packet must not be used afterwards. It is a no-op
+// for packets not received by a Conn.
+func (f *Packet) Release() {
+	if f.buf != nil {
+		f.buf.release()
+	}
+}
@@ -0,0 +1,112 @@
+package rtp
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type datagramConn struct {
+	readCh chan []byte
+	closed chan struct{}
+}
+
+func newDatagramConn() *datagramConn {
+	return &datagramConn{
+		readCh: make(chan []byte, 100),
+		closed: make(chan struct{}),
+	}
+}
+
+func (dc *datagramConn) Read(buf []byte) (int, error) {
+	select {
+	case data := <-dc.readCh:
+		return copy(buf, data), nil
+	case <-dc.closed:
+		return 0, io.EOF
+	}
+}
+
+func (dc *datagramConn) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (dc *datagramConn) Close() error {
+	select {
+	case <-dc.closed:
+	default:
+		close(dc.closed)
+	}
+	return nil
+}
+
+func TestReceiveBufferOwnership(t *testing.T) {
+	dc := newDatagramConn()
+	c := NewConn(dc, 50*time.Millisecond)
+	defer c.Close()
+
+	// every packet is queued before any frame is read
+	for i := 1; i <= 3; i++ {
+		p := &Packet{Seq: uint16(i), Timestamp: uint32(i * 3000), SSRC: 1234, Marker: 1, Payload: []byte{byte(i), byte(i)}}
+		dc.readCh <- p.Encode()
+	}
+
+	s := c.Stream(1234)
+	for i := 1; i <= 3; i++ {
+		f, _ := s.ReadFrame(context.Background())
+		assert.NotNil(t, f)
+		assert.Equal(t, []byte{byte(i), byte(i)}, f.First().Payload)
+		f.Release()
+		assert.Equal(t, uint32(i*3000), f.Timestamp())
+	}
+}
+
+func TestPacketBufferAllocs(t *testing.T) {
+	p := &Packet{
+		Seq:       1,
+		Timestamp: 3000,
+		SSRC:      1234,
+		Extension: &Extension{Profile: 1, Length: 1, HeaderExtensions: make([]byte, 4)},
+		Payload:   make([]byte, 1000),
+	}
+	data := p.Encode()
+	list := NewPacketList()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		b := newPacketBuffer()
+		n := copy(b.data, data)
+		p, err := b.decode(n, Lenient)
+		if err != nil || p.Seq != 1 {
+			t.Fatal("decode failed")
+		}
+
+		list.Insert(p)
+		list.Release()
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestSkipBadPackets(t *testing.T) {
+	dc := newDatagramConn()
+	c := NewConn(dc, 50*time.Millisecond)
+	defer c.Close()
+
+	bad := (&Packet{SSRC: 1234, Payload: []byte{1, 2}}).Encode()
+	bad[0] |= 0x20
+	bad[len(bad)-1] = 200
+	dc.readCh <- bad
+	dc.readCh <- []byte{0x80}
+
+	p := &Packet{Seq: 1, Timestamp: 3000, SSRC: 1234, Marker: 1, Payload: []byte{1, 2}}
+	dc.readCh <- p.Encode()
+
+	f, _ := c.Stream(1234).ReadFrame(context.Background())
+	assert.NotNil(t, f)
+	assert.Equal(t, []byte{1, 2}, f.First().Payload)
+	f.Release()
+	assert.Equal(t, uint64(2), atomic.LoadUint64(&c.(*conn).badPackets))
+}
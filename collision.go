@@ -0,0 +1,239 @@
+package rtp
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// conflictTimeout is how long the source address of a collision with our
+// own SSRC is kept to tell our looped packets, sourceTimeout how long the
+// address of a silent SSRC is kept before another one replaces it, such as
+// after a NAT rebinding (RFC 3550 8.2)
+const (
+	conflictTimeout = 50 * time.Second
+	sourceTimeout   = 5 * time.Second
+)
+
+// interfaceTimeout is how long the addresses of the local interfaces are
+// cached for ownAddr
+const interfaceTimeout = 10 * time.Second
+
+var interfaces struct {
+	sync.Mutex
+	ips     []net.IP
+	updated time.Time
+}
+
+// source is the address of a received SSRC or of a collision, and when it
+// was last seen
+type source struct {
+	addr net.Addr
+	seen time.Time
+}
+
+// Conflict reports a received packet whose SSRC is in use by another source
+type Conflict struct {
+	SSRC uint32
+
+	// Addr is the source of the packet, Known that of the SSRC so far, nil
+	// when not reported by the transport
+	Addr, Known net.Addr
+
+	// Local is set when the SSRC was that of a local sender, which moved to
+	// a new SSRC unless Loop is set: the packet is our own looped back and
+	// was dropped. Other collisions drop the packet, a loop of third party
+	// packets cannot be told apart.
+	Local, Loop bool
+}
+
+// sourceReader is implemented by the transports telling the source address
+// of the last packet read
+type sourceReader interface {
+	sourceAddr() net.Addr
+}
+
+// source returns the source address of the last packet read, nil if the
+// transport does not tell
+func (c *conn) source() net.Addr {
+	if sr, ok := c.ReadWriteCloser.(sourceReader); ok {
+		return sr.sourceAddr()
+	}
+	return nil
+}
+
+// sameSource compares source addresses without allocating for UDP ones
+func sameSource(a, b net.Addr) bool {
+	ua, okA := a.(*net.UDPAddr)
+	ub, okB := b.(*net.UDPAddr)
+	if okA && okB {
+		return sameAddr(ua, ub)
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
+
+// ownAddr reports whether addr is the local address local, such as for our
+// own packets looped back by a multicast group
+func ownAddr(addr, local net.Addr) bool {
+	a, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	l, ok := local.(*net.UDPAddr)
+	if !ok || a.Port != l.Port {
+		return false
+	}
+	if !l.IP.IsUnspecified() {
+		return a.IP.Equal(l.IP)
+	}
+	if a.IP.IsLoopback() {
+		return true
+	}
+	return interfaceIP(a.IP)
+}
+
+// interfaceIP reports whether ip is an address of a local interface
+func interfaceIP(ip net.IP) bool {
+	interfaces.Lock()
+	defer interfaces.Unlock()
+
+	if now := time.Now(); now.Sub(interfaces.updated) > interfaceTimeout {
+		interfaces.ips = interfaces.ips[:0]
+		interfaces.updated = now
+		addrs, _ := net.InterfaceAddrs()
+		for _, ia := range addrs {
+			if ipnet, ok := ia.(*net.IPNet); ok {
+				interfaces.ips = append(interfaces.ips, ipnet.IP)
+			}
+		}
+	}
+
+	for _, lip := range interfaces.ips {
+		if lip.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *conn) OnConflict(handler func(cf Conflict)) {
+	c.Lock()
+	c.onConflict = handler
+	c.Unlock()
+}
+
+// checkSource detects SSRC collisions and loops from the source address of
+// a packet of ssrc, false drops the packet
+func (c *conn) checkSource(ssrc uint32, addr net.Addr) bool {
+	now := time.Now()
+
+	if s := c.lookup(ssrc); s != nil {
+		if _, send := s.stats(); send.sent() {
+			if ownAddr(addr, c.LocalAddr()) {
+				c.log.Debug("own packet dropped", "ssrc", ssrc)
+				return false
+			}
+
+			if c.looped(addr, now) {
+				c.conflict(Conflict{SSRC: ssrc, Addr: addr, Local: true, Loop: true})
+				return false
+			}
+			c.changeSSRC(s)
+			c.conflict(Conflict{SSRC: ssrc, Addr: addr, Local: true})
+		}
+	}
+
+	c.sourceMutex.Lock()
+	known, ok := c.sources[ssrc]
+	switch {
+	case !ok || addr == nil || known.addr == nil || sameSource(addr, known.addr):
+	case now.Sub(known.seen) >= sourceTimeout || sameSource(addr, c.RemoteAddr()):
+		// the source moved, the old address went silent or the transport
+		// latched to the new one
+		c.log.Debug("ssrc source moved", "ssrc", ssrc, "addr", addr, "known", known.addr)
+	default:
+		c.sourceMutex.Unlock()
+		c.conflict(Conflict{SSRC: ssrc, Addr: addr, Known: known.addr})
+		return false
+	}
+	c.sources[ssrc] = source{addr: addr, seen: now}
+	c.sourceMutex.Unlock()
+	return true
+}
+
+// looped records addr as colliding with our own SSRC and reports whether it
+// already did so recently, telling our packets looped back
+func (c *conn) looped(addr net.Addr, now time.Time) bool {
+	c.sourceMutex.Lock()
+	defer c.sourceMutex.Unlock()
+
+	found := false
+	conflicts := c.conflicts[:0]
+	for _, cf := range c.conflicts {
+		if now.Sub(cf.seen) >= conflictTimeout {
+			continue
+		}
+		if sameSource(cf.addr, addr) {
+			found = true
+			cf.seen = now
+		}
+		conflicts = append(conflicts, cf)
+	}
+	if !found {
+		conflicts = append(conflicts, source{addr: addr, seen: now})
+	}
+	c.conflicts = conflicts
+	return found
+}
+
+// changeSSRC moves the local sender s to a new random SSRC and says BYE for
+// the old one
+func (c *conn) changeSSRC(s Stream) {
+	prev := s.SSRC()
+
+	c.Lock()
+	ssrc := rand.Uint32()
+	for c.streams[ssrc] != nil || ssrc == c.ssrc {
+		ssrc = rand.Uint32()
+	}
+	c.streams[ssrc] = s
+	delete(c.streams, prev)
+	w := c.workers[prev]
+	if w != nil {
+		c.workers[ssrc] = w
+		delete(c.workers, prev)
+	}
+	c.Unlock()
+
+	// the worker of s calls its OnSSRCChange handler
+	s.setSSRC(ssrc)
+	if w != nil {
+		w.q.wake()
+	}
+	if err := c.writeRTCP(&Goodbye{Sources: []uint32{prev}}); err != nil {
+		c.log.Warn("rtcp write failed", "err", err)
+	}
+}
+
+// conflict logs cf and passes it to the OnConflict handler
+func (c *conn) conflict(cf Conflict) {
+	c.log.Warn("ssrc conflict", "ssrc", cf.SSRC, "addr", cf.Addr, "known", cf.Known, "local", cf.Local, "loop", cf.Loop)
+
+	c.Lock()
+	handler := c.onConflict
+	c.Unlock()
+	if handler != nil {
+		handler(cf)
+	}
+}
+
+// forgetSource drops the source address of ssrc
+func (c *conn) forgetSource(ssrc uint32) {
+	c.sourceMutex.Lock()
+	delete(c.sources, ssrc)
+	c.sourceMutex.Unlock()
+}
@@ -0,0 +1,136 @@
+package rtp
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// addrConn is a datagramConn reporting the source of the packets read
+type addrConn struct {
+	*datagramConn
+	mutex sync.Mutex
+	addr  net.Addr
+}
+
+func (ac *addrConn) sourceAddr() net.Addr {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	return ac.addr
+}
+
+func (ac *addrConn) send(p *Packet, addr string) {
+	ac.mutex.Lock()
+	ac.addr, _ = net.ResolveUDPAddr("udp", addr)
+	ac.mutex.Unlock()
+	ac.readCh <- p.Encode()
+	time.Sleep(20 * time.Millisecond)
+}
+
+type byeInterceptor struct {
+	NoopInterceptor
+	mutex sync.Mutex
+	bye   []uint32
+}
+
+func (bi *byeInterceptor) OutboundRTCP(next RTCPHandler) RTCPHandler {
+	return func(pkts []RTCPPacket) error {
+		bi.mutex.Lock()
+		for _, p := range pkts {
+			if b, ok := p.(*Goodbye); ok {
+				bi.bye = append(bi.bye, b.Sources...)
+			}
+		}
+		bi.mutex.Unlock()
+		return next(pkts)
+	}
+}
+
+func TestSSRCCollision(t *testing.T) {
+	ac := &addrConn{datagramConn: newDatagramConn()}
+	bi := &byeInterceptor{}
+	c := NewConn(ac, time.Second, WithInterceptors(bi))
+	defer c.Close()
+
+	var (
+		mutex     sync.Mutex
+		changes   [][2]uint32
+		onWorker  bool
+		conflicts []Conflict
+	)
+	c.OnConflict(func(cf Conflict) {
+		mutex.Lock()
+		conflicts = append(conflicts, cf)
+		mutex.Unlock()
+	})
+
+	s := c.Stream(1234)
+	s.OnSSRCChange(func(prev, ssrc uint32) {
+		// the handler runs on the dispatch worker of the stream
+		stack := make([]byte, 4096)
+		stack = stack[:runtime.Stack(stack, false)]
+
+		mutex.Lock()
+		changes = append(changes, [2]uint32{prev, ssrc})
+		onWorker = bytes.Contains(stack, []byte("(*conn).dispatchPump"))
+		mutex.Unlock()
+	})
+	_, err := s.WriteFrame([]byte{1}, 96, 3000, nil)
+	assert.Nil(t, err)
+
+	// a remote source takes our SSRC, we move
+	ac.send(&Packet{Seq: 1, SSRC: 1234, Marker: 1, Payload: []byte{1}}, "10.0.0.1:5000")
+	ssrc := s.SSRC()
+	assert.NotEqual(t, uint32(1234), ssrc)
+	assert.Equal(t, 2, len(c.Streams()))
+
+	// our packets come back from the same address
+	ac.send(&Packet{Seq: 2, SSRC: ssrc, Marker: 1, Payload: []byte{1}}, "10.0.0.1:5000")
+	assert.Equal(t, ssrc, s.SSRC())
+
+	// a third party takes the SSRC of the remote source
+	ac.send(&Packet{Seq: 3, SSRC: 1234, Marker: 1, Payload: []byte{1}}, "10.0.0.2:5000")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, [][2]uint32{{1234, ssrc}}, changes)
+	assert.True(t, onWorker)
+	assert.Equal(t, 3, len(conflicts))
+	assert.True(t, conflicts[0].Local && !conflicts[0].Loop)
+	assert.True(t, conflicts[1].Local && conflicts[1].Loop)
+	assert.Equal(t, uint32(1234), conflicts[2].SSRC)
+	assert.False(t, conflicts[2].Local)
+	assert.Equal(t, "10.0.0.1:5000", conflicts[2].Known.String())
+	assert.Equal(t, "10.0.0.2:5000", conflicts[2].Addr.String())
+
+	bi.mutex.Lock()
+	defer bi.mutex.Unlock()
+	assert.Equal(t, []uint32{1234}, bi.bye)
+}
+
+func TestOwnAddr(t *testing.T) {
+	local := &net.UDPAddr{IP: net.IPv4zero, Port: 5004}
+	assert.True(t, ownAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5004}, local))
+	assert.False(t, ownAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5006}, local))
+	assert.False(t, ownAddr(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5004}, local))
+
+	addrs, err := net.InterfaceAddrs()
+	assert.Nil(t, err)
+	for _, ia := range addrs {
+		if ipnet, ok := ia.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			assert.True(t, ownAddr(&net.UDPAddr{IP: ipnet.IP, Port: 5004}, local))
+		}
+	}
+
+	// the interface addresses are cached
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5004}
+	allocs := testing.AllocsPerRun(100, func() {
+		ownAddr(addr, local)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
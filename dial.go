@@ -0,0 +1,224 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// Dialer contains options for connecting to a RTP peer over UDP
+type Dialer struct {
+	// LocalAddr is the local address to bind, empty means any
+	LocalAddr string
+
+	// Timeout is the frame read timeout of the Conn
+	Timeout time.Duration
+
+	// Latch enables symmetric RTP (RFC 4961): the send destination follows
+	// the source address of valid incoming packets, which traverses NATs
+	// and survives rebinding.
+	Latch bool
+
+	// LatchPackets is the number of consecutive valid packets required from
+	// a new source address before latching to it, 0 means 1
+	LatchPackets int
+
+	// SSRC, if not 0, is the only remote SSRC accepted for latching. When 0
+	// the SSRC of the first latched source is pinned for relatching.
+	SSRC uint32
+
+	// Authenticate, if set, must accept a packet before it is considered for
+	// latching, e.g. a SRTP authentication tag check
+	Authenticate func(data []byte) bool
+
+	// Batch moves packets in batches, see NewBatchConn
+	Batch bool
+
+	// Options configure the Conn, such as WithInterceptors
+	Options []ConnOption
+}
+
+// Dial connects to the RTP peer at address
+func Dial(network, address string) (Conn, error) {
+	var d Dialer
+	return d.Dial(network, address)
+}
+
+func (d *Dialer) Dial(network, address string) (Conn, error) {
+	raddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var laddr *net.UDPAddr
+	if d.LocalAddr != "" {
+		laddr, err = net.ResolveUDPAddr(network, d.LocalAddr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pc, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	uc := &udpConn{
+		UDPConn: pc,
+		dialer:  *d,
+		remote:  raddr,
+		ssrc:    d.SSRC,
+	}
+
+	if d.Batch {
+		if b := newBatcher(pc); b != nil {
+			return NewConn(&batchUDPConn{udpConn: uc, b: b}, d.Timeout, d.Options...), nil
+		}
+	}
+	return NewConn(uc, d.Timeout, d.Options...), nil
+}
+
+// udpConn is an unconnected UDP socket bound to a single peer
+type udpConn struct {
+	*net.UDPConn
+	dialer Dialer
+
+	mutex     sync.Mutex
+	remote    *net.UDPAddr
+	ssrc      uint32
+	candidate *net.UDPAddr
+	count     int
+
+	// source of the last packet read
+	source net.Addr
+}
+
+func (uc *udpConn) Read(buf []byte) (int, error) {
+	for {
+		n, addr, err := uc.ReadFromUDP(buf)
+		if err != nil {
+			return n, err
+		}
+
+		if uc.accept(buf[:n], addr) {
+			uc.source = addr
+			return n, nil
+		}
+	}
+}
+
+func (uc *udpConn) sourceAddr() net.Addr {
+	return uc.source
+}
+
+func (uc *udpConn) accept(data []byte, addr *net.UDPAddr) bool {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+
+	if sameAddr(addr, uc.remote) {
+		uc.candidate = nil
+		uc.count = 0
+		if uc.ssrc == 0 && uc.dialer.Latch && !shortPacket(data) {
+			uc.ssrc = packetSSRC(data)
+		}
+		return true
+	}
+
+	if !uc.dialer.Latch || !uc.valid(data) {
+		return false
+	}
+
+	if sameAddr(addr, uc.candidate) {
+		uc.count += 1
+	} else {
+		uc.candidate = addr
+		uc.count = 1
+	}
+
+	if uc.count >= uc.dialer.LatchPackets {
+		uc.remote = addr
+		uc.ssrc = packetSSRC(data)
+		uc.candidate = nil
+		uc.count = 0
+	}
+	return true
+}
+
+// valid checks a packet from an unknown source before latching to it
+func (uc *udpConn) valid(data []byte) bool {
+	if shortPacket(data) || data[0]>>6 != 2 {
+		return false
+	}
+
+	if uc.ssrc != 0 && packetSSRC(data) != uc.ssrc {
+		return false
+	}
+
+	if uc.dialer.Authenticate != nil && !uc.dialer.Authenticate(data) {
+		return false
+	}
+	return true
+}
+
+func (uc *udpConn) Write(data []byte) (int, error) {
+	return uc.WriteToUDP(data, uc.RemoteAddr().(*net.UDPAddr))
+}
+
+func (uc *udpConn) RemoteAddr() net.Addr {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+	return uc.remote
+}
+
+type batchUDPConn struct {
+	*udpConn
+	b     *batcher
+	addrs []net.Addr
+}
+
+func (bc *batchUDPConn) ReadBatch(bufs [][]byte, sizes []int) (int, error) {
+	if len(bc.addrs) < len(bufs) {
+		bc.addrs = make([]net.Addr, len(bufs))
+	}
+
+	for {
+		n, err := bc.b.readBatch(bufs, sizes, bc.addrs)
+
+		accepted := 0
+		for i := 0; i < n; i++ {
+			addr, _ := bc.addrs[i].(*net.UDPAddr)
+			if !bc.accept(bufs[i][:sizes[i]], addr) {
+				continue
+			}
+			if accepted != i {
+				copy(bufs[accepted], bufs[i][:sizes[i]])
+			}
+			sizes[accepted] = sizes[i]
+			accepted += 1
+		}
+
+		if accepted > 0 || err != nil {
+			return accepted, err
+		}
+	}
+}
+
+func (bc *batchUDPConn) WriteBatch(bufs [][]byte) (int, error) {
+	return bc.b.writeBatch(bufs, bc.RemoteAddr())
+}
+
+// packetSSRC returns the sender SSRC of a RTP or RTCP packet
+func packetSSRC(data []byte) uint32 {
+	if isRTCP(data) {
+		return binary.BigEndian.Uint32(data[4:])
+	}
+	return binary.BigEndian.Uint32(data[8:])
+}
+
+func sameAddr(a, b *net.UDPAddr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Port == b.Port && a.IP.Equal(b.IP) && a.Zone == b.Zone
+}
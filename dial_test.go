@@ -0,0 +1,97 @@
+package rtp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialLatch(t *testing.T) {
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.Nil(t, err)
+	defer peer.Close()
+
+	// the signaled address is not where the peer sends from
+	d := Dialer{
+		LocalAddr: "127.0.0.1:0",
+		Timeout:   time.Second,
+		Latch:     true,
+		SSRC:      1234,
+	}
+	c, err := d.Dial("udp", "127.0.0.1:9")
+	assert.Nil(t, err)
+	defer c.Close()
+
+	spoofed := &Packet{Seq: 1, SSRC: 4321, Marker: 1, Payload: []byte{1}}
+	_, err = peer.WriteToUDP(spoofed.Encode(), c.LocalAddr().(*net.UDPAddr))
+	assert.Nil(t, err)
+
+	p := &Packet{Seq: 1, SSRC: 1234, Marker: 1, Payload: []byte{1}}
+	_, err = peer.WriteToUDP(p.Encode(), c.LocalAddr().(*net.UDPAddr))
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		return c.RemoteAddr().String() == peer.LocalAddr().String()
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = c.Stream(5678).WriteFrame([]byte{1, 2, 3}, 96, 3000, nil)
+	assert.Nil(t, err)
+
+	buf := make([]byte, 1500)
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := peer.ReadFromUDP(buf)
+	assert.Nil(t, err)
+
+	received := &Packet{}
+	assert.True(t, received.Decode(buf[:n]) > 0)
+	assert.Equal(t, uint32(5678), received.SSRC)
+}
+
+func TestDialRebinding(t *testing.T) {
+	d := Dialer{
+		LocalAddr: "127.0.0.1:0",
+		Timeout:   100 * time.Millisecond,
+		Latch:     true,
+		SSRC:      1234,
+	}
+	c, err := d.Dial("udp", "127.0.0.1:9")
+	assert.Nil(t, err)
+	defer c.Close()
+
+	var (
+		mutex     sync.Mutex
+		conflicts []Conflict
+	)
+	c.OnConflict(func(cf Conflict) {
+		mutex.Lock()
+		conflicts = append(conflicts, cf)
+		mutex.Unlock()
+	})
+	s := c.Stream(1234)
+
+	// the peer sends from a new port after a NAT rebinding
+	for i := 0; i < 2; i++ {
+		peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.Nil(t, err)
+		defer peer.Close()
+
+		p := &Packet{Seq: uint16(i), Timestamp: uint32(i) * 3000, SSRC: 1234, Marker: 1, Payload: []byte{1}}
+		_, err = peer.WriteToUDP(p.Encode(), c.LocalAddr().(*net.UDPAddr))
+		assert.Nil(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		f, err := s.ReadFrame(ctx)
+		cancel()
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(i)*3000, f.Timestamp())
+		assert.Equal(t, peer.LocalAddr().String(), c.RemoteAddr().String())
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Empty(t, conflicts)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -11,155 +10,69 @@ import (
 	"github.com/yingshulu/rtp"
 )
 
-type Conn struct {
-	addr    *net.UDPAddr
-	readCh  chan []byte
-	conn    *net.UDPConn
-	timeout time.Duration
-	buffer  bytes.Buffer
-	closed  bool
-}
-
-func NewClientConn(addr *net.UDPAddr, conn *net.UDPConn) *Conn {
-	return &Conn{
-		addr:    addr,
-		conn:    conn,
-		timeout: 10 * time.Second,
-		readCh:  make(chan []byte, 20),
-		buffer:  *bytes.NewBuffer(nil),
-	}
-}
-
-func (c *Conn) Read(buf []byte) (int, error) {
-	if c.closed {
-		return 0, errors.New("udp client closed")
-	}
-
-	if c.buffer.Len() == 0 {
-		select {
-		case <-time.After(c.timeout):
-			return 0, errors.New("timeout")
-
-		case data := <-c.readCh:
-			_, err := c.buffer.Write(data)
-			if err != nil {
-				return 0, err
-			}
-		}
-	}
-
-	fmt.Println("server Conn read buf: ", c.buffer.Len())
-	fmt.Println("server Conn read buffer size: ", len(buf))
-	n, err := c.buffer.Read(buf)
-	if err != nil {
-		fmt.Println("server Conn buf truncate: ", err)
-	}
-
-	fmt.Println("server Conn buf left: ", c.buffer.Len())
-
-	return n, err
-}
-
-func (c *Conn) Write(data []byte) (int, error) {
-	if c.closed {
-		return 0, errors.New("udp client closed")
-	}
-	return c.conn.WriteToUDP(data, c.addr)
-}
-
-func (c *Conn) Close() error {
-	c.closed = true
-	return nil
-}
-
 func processFrame(f *rtp.Frame) {
 
 }
 
-func handleRtp(c *Conn) {
-	pc := rtp.NewConn(c, c.timeout)
+func handleRtp(pc rtp.Conn) {
+	defer pc.Close()
 	s := pc.Stream(1234)
 
-	exec := func() {
+	// exec reads a frame, false once the session is closed
+	exec := func() bool {
 		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 		defer cancel()
 
 		f, err := s.ReadFrame(ctx)
-		if f != nil {
-			processFrame(f)
-		} else {
+		if errors.Is(err, rtp.ErrClosed) {
+			if f != nil {
+				f.Release()
+			}
+			return false
+		}
+		if f == nil {
 			//skip this frame?
-			return
+			return true
 		}
 
+		processFrame(f)
+		f.Release()
 		if err != nil {
 			fmt.Println("read frame error ", err)
-			return
 		}
+		return true
 	}
 
-	for {
-		exec()
+	for exec() {
 	}
+	fmt.Println("rtp session closed: ", pc.RemoteAddr(), pc.Err())
 }
 
-type UdpServer struct {
-	closed  bool
-	clients map[string]*Conn
-}
-
-func NewUdpServer() *UdpServer {
-	return &UdpServer{
-		clients: map[string]*Conn{},
-	}
-}
-
-func (u *UdpServer) Serve(addr string) error {
-	listenAddr, err := net.ResolveUDPAddr("udp", addr)
-	if err != nil {
-		return err
+func main() {
+	lc := rtp.ListenConfig{
+		Timeout:     10 * time.Second,
+		IdleTimeout: time.Minute,
+		MaxConns:    1024,
 	}
 
-	conn, err := net.ListenUDP("udp", listenAddr)
+	l, err := lc.Listen("udp", "127.0.0.1:8765")
 	if err != nil {
-		return err
+		fmt.Println("udp server failure: ", err)
+		return
 	}
+	defer l.Close()
 
-	for !u.closed {
-		buf := make([]byte, 1500)
-		n, clientAddr, err := conn.ReadFromUDP(buf)
-		if n > 0 {
-			fmt.Println("udp server read buffer: ", n)
+	for {
+		c, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
 		}
 		if err != nil {
-			continue
-		}
-
-		fmt.Println("udp recv buffer: ", n)
-
-		cc, ok := u.clients[clientAddr.String()]
-		if !ok {
-			cc = NewClientConn(clientAddr, conn)
-			u.clients[clientAddr.String()] = cc
-			go handleRtp(cc)
+			fmt.Println("udp server accept failure: ", err)
+			return
 		}
-		cc.readCh <- buf[:n]
-	}
-	return nil
-}
 
-func (u *UdpServer) Close() error {
-	u.closed = true
-	for _, c := range u.clients {
-		c.Close()
-	}
-	return nil
-}
-
-func main() {
-	u := NewUdpServer()
-	err := u.Serve("127.0.0.1:8765")
-	if err != nil {
-		fmt.Println("udp server failure: ", err)
+		fmt.Println("new rtp session: ", c.RemoteAddr())
+		go handleRtp(c)
 	}
 }
@@ -2,7 +2,9 @@ package rtp
 
 import (
 	"context"
+	"io"
 	"sync"
+	"time"
 )
 
 const (
@@ -14,7 +16,7 @@ const (
 func NewFrame(prevFrame *Frame) *Frame {
 	return &Frame{
 		PacketList: NewPacketList(),
-		done:       make(chan bool),
+		done:       make(chan struct{}),
 		prevFrame:  prevFrame,
 	}
 }
@@ -22,38 +24,333 @@ func NewFrame(prevFrame *Frame) *Frame {
 type Frame struct {
 	PacketList
 	prevFrame *Frame
-	done      chan bool
+	done      chan struct{}
+	completed bool
+
+	// timestamp of an empty frame and summary of a released frame, still
+	// needed by the following frame
+	mutex     sync.Mutex
+	released  bool
+	timestamp uint32
+	lastSeq   uint16
+	full      bool
+
+	// trailing counts the padding-only packets following the frame
+	trailing uint16
+
+	// arrival and latest are the times the first and last packets were
+	// received
+	arrival time.Time
+	latest  time.Time
+
+	// size is the payload size of the packets
+	size int
+
+	// nextTS is the timestamp of the following frame and clockRate that of
+	// the timestamps, for Duration
+	nextTS    uint32
+	hasNext   bool
+	clockRate uint32
+
+	// summary of the previous frame once unlinked
+	unlinked bool
+	prevFull bool
+	prevSeq  uint16
+	prevTS   uint32
+
+	// clock maps the timestamp to the wall clock, for CaptureTime
+	clock *receiverStats
 }
 
-func (f *Frame) Done() <-chan bool {
+// link makes prev the frame before f
+func link(prev, f *Frame) {
+	ts := f.Timestamp()
+	f.mutex.Lock()
+	f.prevFrame = prev
+	f.mutex.Unlock()
+
+	prev.mutex.Lock()
+	prev.nextTS, prev.hasNext = ts, true
+	prev.mutex.Unlock()
+}
+
+// unlink keeps a summary of the previous frame instead of the frame, once f
+// receives no more packets, so that frames do not hold every older one
+func (f *Frame) unlink() {
+	f.mutex.Lock()
+	prev := f.prevFrame
+	f.mutex.Unlock()
+	if prev == nil {
+		return
+	}
+
+	full, seq, ts := prev.isFull(), prev.lastSequence(), prev.Timestamp()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.prevFrame == prev {
+		f.prevFrame = nil
+		f.unlinked = true
+		f.prevFull, f.prevSeq, f.prevTS = full, seq, ts
+	}
+}
+
+// Done is closed once the frame is complete. It used to deliver true on
+// completion, as a closed channel it now unblocks every receiver like
+// Conn.Done.
+func (f *Frame) Done() <-chan struct{} {
 	return f.done
 }
 
+// complete signals the frame complete without waiting for a reader, the
+// mutex must be held
+func (f *Frame) complete() {
+	if !f.completed {
+		f.completed = true
+		close(f.done)
+	}
+}
+
 func (f *Frame) Timestamp() uint32 {
-	if f.First() == nil {
-		return 0
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.timestampLocked()
+}
+
+func (f *Frame) timestampLocked() uint32 {
+	if f.released || f.First() == nil {
+		return f.timestamp
 	}
 	return f.First().Timestamp
 }
 
+// Len returns the payload size of the frame, 0 once released
+func (f *Frame) Len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released {
+		return 0
+	}
+	return f.size
+}
+
+// Bytes returns the payloads of the packets concatenated
+func (f *Frame) Bytes() []byte {
+	return f.AppendBytes(make([]byte, 0, f.Len()))
+}
+
+// AppendBytes appends the payloads of the packets to buf, reusing buf
+// avoids allocating a new slice per frame
+func (f *Frame) AppendBytes(buf []byte) []byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released {
+		return buf
+	}
+	cur := f.NewCursor()
+	for p := cur.Next(); p != nil; p = cur.Next() {
+		buf = append(buf, p.Payload...)
+	}
+	return buf
+}
+
+// WriteTo writes the payloads of the packets to w
+func (f *Frame) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, p := range f.Packets() {
+		n, err := w.Write(p.Payload)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Packets returns the packets of the frame in sequence order
+func (f *Frame) Packets() []*Packet {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released {
+		return nil
+	}
+	packets := make([]*Packet, 0, f.Count())
+	cur := f.NewCursor()
+	for p := cur.Next(); p != nil; p = cur.Next() {
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+// PayloadType returns the payload type of the first packet
+func (f *Frame) PayloadType() byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released || f.First() == nil {
+		return 0
+	}
+	return f.First().PT
+}
+
+// Marker reports whether the last packet has the marker bit
+func (f *Frame) Marker() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released || f.Last() == nil {
+		return false
+	}
+	return f.Last().Marker == 1
+}
+
+// ArrivalTime returns the times the first and the last packets were
+// received
+func (f *Frame) ArrivalTime() (first, last time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.arrival, f.latest
+}
+
+// CaptureTime returns the sampling instant of the frame in the wall clock
+// of the sender, false until its stream receives a sender report
+func (f *Frame) CaptureTime() (time.Time, bool) {
+	f.mutex.Lock()
+	clock, ts := f.clock, f.timestampLocked()
+	f.mutex.Unlock()
+
+	if clock == nil {
+		return time.Time{}, false
+	}
+	return clock.wallClock(ts)
+}
+
+// Duration returns the time to the timestamp of the next frame, 0 until
+// it is received
+func (f *Frame) Duration() time.Duration {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.hasNext {
+		return 0
+	}
+	rate := f.clockRate
+	if rate == 0 {
+		rate = defaultClockRate
+	}
+	d := int32(f.nextTS - f.timestampLocked())
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(int64(d) * int64(time.Second) / int64(rate))
+}
+
+// Release returns the packets of the frame to the receive buffer pool. The
+// packets and their payloads must not be used afterwards, call Retain on a
+// packet to keep it.
+func (f *Frame) Release() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released {
+		return
+	}
+
+	f.released = true
+	f.full = f.IsFull()
+	if first := f.First(); first != nil {
+		f.timestamp = first.Timestamp
+		f.lastSeq = f.Last().Seq
+	}
+	f.PacketList.Release()
+}
+
+// IsComplete reports whether the frame has every packet up to its marker,
+// following the last packet of the previous frame if there is one
+func (f *Frame) IsComplete() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.completed {
+		return true
+	}
+	if f.prevFrame != nil || f.unlinked {
+		return false
+	}
+	if f.released {
+		return f.full
+	}
+	return f.IsFull()
+}
+
+// SeqRange is an inclusive range of sequence numbers
+type SeqRange struct {
+	First, Last uint16
+}
+
+// Missing returns the sequence ranges missing from the frame. A frame
+// without its marker packet misses at least the sequence following its last
+// packet, reported as such. A released frame returns nil.
+func (f *Frame) Missing() []SeqRange {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released || f.First() == nil {
+		return nil
+	}
+	expected := f.First().Seq
+	if f.prevFrameStatus() == prevFrameOk {
+		expected = f.prevFrameSeq() + 1
+	}
+
+	var missing []SeqRange
+	cur := f.NewCursor()
+	for p := cur.Next(); p != nil; p = cur.Next() {
+		if p.Seq != expected {
+			missing = append(missing, SeqRange{First: expected, Last: p.Seq - 1})
+		}
+		expected = p.Seq + 1
+	}
+	if f.Last().Marker == 0 {
+		missing = append(missing, SeqRange{First: expected, Last: expected})
+	}
+	return missing
+}
+
 // Push Packet
 func (f *Frame) Push(p *Packet) int {
 	if p == nil {
 		return DenyPacketNil
 	}
 
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.released {
+		return DenyFrameReleased
+	}
+
+	ok := Deny
 	switch f.prevFrameStatus() {
 	case prevFrameNone:
-		return f.pushFirstFrame(p)
+		ok = f.pushFirstFrame(p)
 
 	case prevFrameDrain:
-		return f.pushAfterDrain(p)
+		ok = f.pushAfterDrain(p)
 
 	case prevFrameOk:
-		return f.pushAfterOk(p)
+		ok = f.pushAfterOk(p)
 	}
 
-	return Deny
+	if ok == AcceptOk {
+		f.size += len(p.Payload)
+		f.latest = time.Now()
+		if f.arrival.IsZero() {
+			f.arrival = f.latest
+		}
+	}
+	return ok
 }
 
 func (f *Frame) pushFirstFrame(p *Packet) int {
@@ -61,6 +358,13 @@ func (f *Frame) pushFirstFrame(p *Packet) int {
 		return DenyTimestampInvalid
 	}
 
+	// without a previous frame a full frame is complete
+	defer func() {
+		if f.IsFull() {
+			f.complete()
+		}
+	}()
+
 	return f.Insert(p)
 }
 
@@ -75,7 +379,7 @@ func (f *Frame) pushAfterDrain(p *Packet) int {
 
 	defer func() {
 		if f.IsFull() && f.prevFrameSeq()+1 == f.First().Seq {
-			f.done <- true
+			f.complete()
 		}
 	}()
 
@@ -97,19 +401,38 @@ func (f *Frame) pushAfterOk(p *Packet) int {
 
 	defer func() {
 		if f.IsFull() && f.prevFrameSeq()+1 == f.First().Seq {
-			f.done <- true
+			f.complete()
 		}
 	}()
 
 	return f.Insert(p)
 }
 
+// recheck completes f once its previous frame is full and followed by f,
+// such as after a packet reordered across their boundary
+func (f *Frame) recheck() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.completed || f.released || f.First() == nil {
+		return
+	}
+	if f.prevFrameStatus() == prevFrameOk && f.IsFull() && f.prevFrameSeq()+1 == f.First().Seq {
+		f.complete()
+	}
+}
+
+// prevFrameStatus, prevFrameSeq and prevFrameTimestamp read the previous
+// frame or its summary once unlinked, the mutex must be held
 func (f *Frame) prevFrameStatus() int {
-	if f.prevFrame == nil {
+	full := f.prevFull
+	if f.prevFrame != nil {
+		full = f.prevFrame.isFull()
+	} else if !f.unlinked {
 		return prevFrameNone
 	}
 
-	if f.prevFrame.IsFull() {
+	if full {
 		return prevFrameOk
 	}
 
@@ -118,16 +441,57 @@ func (f *Frame) prevFrameStatus() int {
 
 func (f *Frame) prevFrameSeq() uint16 {
 	if f.prevFrame == nil {
-		return 0
+		return f.prevSeq
 	}
-	return f.prevFrame.Last().Seq
+	return f.prevFrame.lastSequence()
 }
 
 func (f *Frame) prevFrameTimestamp() uint32 {
 	if f.prevFrame == nil {
+		return f.prevTS
+	}
+	return f.prevFrame.Timestamp()
+}
+
+func (f *Frame) isFull() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released {
+		return f.full
+	}
+	return f.IsFull()
+}
+
+func (f *Frame) lastSequence() uint16 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.released {
+		return f.lastSeq + f.trailing
+	}
+	if f.Last() == nil {
 		return 0
 	}
-	return f.prevFrame.First().Timestamp
+	return f.Last().Seq + f.trailing
+}
+
+// pad accounts a padding-only packet sharing the timestamp of the frame, so
+// that the following frame still finds a contiguous sequence.
+func (f *Frame) pad(seq uint16) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	last := f.lastSeq
+	if !f.released {
+		if f.Last() == nil {
+			return
+		}
+		last = f.Last().Seq
+	}
+	if seq == last+f.trailing+1 {
+		f.trailing += 1
+	}
 }
 
 func NewFrameWaitQueue() *FrameWaitQueue {
@@ -135,13 +499,60 @@ func NewFrameWaitQueue() *FrameWaitQueue {
 		mutex:  &sync.Mutex{},
 		queue:  NewFrameQueue(),
 		notify: make(chan int, 1),
+		closed: make(chan struct{}),
 	}
 }
 
 type FrameWaitQueue struct {
-	mutex  *sync.Mutex
-	queue  FrameQueue
-	notify chan int
+	mutex     *sync.Mutex
+	queue     FrameQueue
+	notify    chan int
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Close wakes up every Pop, which returns ErrClosed from then on
+func (fw *FrameWaitQueue) Close() {
+	fw.closeOnce.Do(func() {
+		close(fw.closed)
+	})
+}
+
+func (fw *FrameWaitQueue) empty() bool {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+	return fw.queue.Empty()
+}
+
+// walk calls fn with the queued frames oldest first, fn must not use the
+// queue
+func (fw *FrameWaitQueue) walk(fn func(f *Frame)) {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fq, ok := fw.queue.(*frameQueue); ok {
+		for n := fq.head; n != nil; n = n.next {
+			fn(n.frame)
+		}
+	}
+}
+
+// peek returns the oldest queued frame, nil if none
+func (fw *FrameWaitQueue) peek() *Frame {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+	return fw.queue.Peek()
+}
+
+// remove takes f out of the queue, false if it is not queued
+func (fw *FrameWaitQueue) remove(f *Frame) bool {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	if fq, ok := fw.queue.(*frameQueue); ok {
+		return fq.remove(f)
+	}
+	return false
 }
 
 func (fw *FrameWaitQueue) Push(f *Frame) bool {
@@ -151,12 +562,22 @@ func (fw *FrameWaitQueue) Push(f *Frame) bool {
 	empty := fw.queue.Empty()
 	res := fw.queue.Push(f)
 	if res && empty {
-		fw.notify <- 1
+		// a notification left by a Pop finding the frame is enough
+		select {
+		case fw.notify <- 1:
+		default:
+		}
 	}
 	return res
 }
 
 func (fw *FrameWaitQueue) Pop(ctx context.Context) (*Frame, error) {
+	select {
+	case <-fw.closed:
+		return nil, ErrClosed
+	default:
+	}
+
 	// first check
 	fw.mutex.Lock()
 	f := fw.queue.Pop()
@@ -166,10 +587,12 @@ func (fw *FrameWaitQueue) Pop(ctx context.Context) (*Frame, error) {
 	}
 
 	// second loop check
-	for fw.queue.Empty() {
+	for fw.empty() {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
+		case <-fw.closed:
+			return nil, ErrClosed
 		case <-fw.notify:
 			fw.mutex.Lock()
 			f := fw.queue.Pop()
@@ -235,7 +658,7 @@ func (fq *frameQueue) Push(f *Frame) (res bool) {
 	if hc == 0 {
 		return
 	} else if hc < 0 {
-		fq.head.frame.prevFrame = f
+		link(f, fq.head.frame)
 		newNode.next = fq.head
 		fq.head = newNode
 		return
@@ -246,7 +669,7 @@ func (fq *frameQueue) Push(f *Frame) (res bool) {
 	if tc == 0 {
 		return
 	} else if tc > 0 {
-		f.prevFrame = fq.tail.frame
+		link(fq.tail.frame, f)
 		fq.tail.next = newNode
 		fq.tail = newNode
 		return
@@ -262,8 +685,8 @@ func (fq *frameQueue) Push(f *Frame) (res bool) {
 		} else if comp > 0 {
 			prev.next = newNode
 			newNode.next = curr
-			f.prevFrame = prev.frame
-			curr.frame.prevFrame = f
+			link(prev.frame, f)
+			link(f, curr.frame)
 			return
 		}
 		prev = curr
@@ -289,3 +712,24 @@ func (fq *frameQueue) Peek() *Frame {
 	}
 	return nil
 }
+
+// remove unlinks f, the following frame keeps f as its previous frame
+func (fq *frameQueue) remove(f *Frame) bool {
+	var prev *frameNode
+	for n := fq.head; n != nil; prev, n = n, n.next {
+		if n.frame != f {
+			continue
+		}
+		if prev == nil {
+			fq.head = n.next
+		} else {
+			prev.next = n.next
+		}
+		if fq.tail == n {
+			fq.tail = prev
+		}
+		fq.count -= 1
+		return true
+	}
+	return false
+}
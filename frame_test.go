@@ -1,7 +1,10 @@
 package rtp
 
 import (
+	"bytes"
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,3 +45,205 @@ func Test_FrameQueue(t *testing.T) {
 		exec(item)
 	}
 }
+
+func TestFrameMissing(t *testing.T) {
+	prev := NewFrame(nil)
+	prev.Push(&Packet{Seq: 0, Timestamp: 0, Marker: 1})
+	assert.True(t, prev.IsComplete())
+	assert.Nil(t, prev.Missing())
+
+	f := NewFrame(prev)
+	f.Push(&Packet{Seq: 2, Timestamp: 3000})
+	f.Push(&Packet{Seq: 4, Timestamp: 3000})
+	assert.False(t, f.IsComplete())
+	assert.Equal(t, []SeqRange{{1, 1}, {3, 3}, {5, 5}}, f.Missing())
+
+	f.Push(&Packet{Seq: 5, Timestamp: 3000, Marker: 1})
+	assert.Equal(t, []SeqRange{{1, 1}, {3, 3}}, f.Missing())
+}
+
+func TestIncompletePolicy(t *testing.T) {
+	key := func(p *Packet) bool {
+		return p.Payload[0] == 1
+	}
+
+	cases := []struct {
+		policy    IncompletePolicy
+		timestamp uint32
+		err       error
+		dropped   map[string]int
+	}{
+		{IncompleteWait, 3000, ErrFrameTimeout, nil},
+		{IncompletePartial, 3000, nil, nil},
+		{IncompleteSkip, 6000, nil, map[string]int{"incomplete": 1}},
+		{IncompleteSkipToKey, 9000, nil, map[string]int{"incomplete": 1, "awaiting_key": 1}},
+	}
+	for _, c := range cases {
+		m := &countMetrics{}
+		s := NewStream(1234, 20*time.Millisecond, nil,
+			WithIncompletePolicy(c.policy), withStreamKeyFrame(key), withStreamMetrics(m))
+		push := func(seq uint16, ts uint32, marker byte, payload byte) {
+			s.dispatch(&Packet{Seq: seq, Timestamp: ts, SSRC: 1234, Marker: marker, Payload: []byte{payload}})
+		}
+
+		push(1, 0, 1, 1)
+		f, err := s.ReadFrame(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(0), f.Timestamp())
+
+		// sequence 3 is lost
+		push(2, 3000, 0, 1)
+		push(4, 3000, 1, 1)
+		push(5, 6000, 1, 0)
+		push(6, 9000, 1, 1)
+
+		f, err = s.ReadFrame(context.Background())
+		assert.Equal(t, c.err, err)
+		assert.Equal(t, c.timestamp, f.Timestamp())
+		if c.policy == IncompletePartial {
+			assert.Equal(t, []SeqRange{{3, 3}}, f.Missing())
+		}
+
+		m.mutex.Lock()
+		assert.Equal(t, c.dropped, m.framesDropped)
+		m.mutex.Unlock()
+	}
+}
+
+func TestFrameLimits(t *testing.T) {
+	var evicted []uint32
+	m := &countMetrics{}
+	s := NewStream(1234, 20*time.Millisecond, nil,
+		WithFrameLimits(2, 0, 20*time.Millisecond),
+		WithEvictHandler(func(f *Frame, reason string) {
+			evicted = append(evicted, f.Timestamp())
+		}),
+		withStreamKeyFrame(func(p *Packet) bool {
+			return p.Payload[0] == 1
+		}),
+		withStreamMetrics(m))
+	push := func(seq uint16, ts uint32, payload byte) {
+		s.dispatch(&Packet{Seq: seq, Timestamp: ts, SSRC: 1234, Marker: 1, Payload: []byte{payload}})
+	}
+
+	// the oldest non key frames make room
+	push(1, 0, 1)
+	push(2, 3000, 0)
+	push(3, 6000, 0)
+	push(4, 9000, 1)
+	assert.Equal(t, []uint32{3000, 6000}, evicted)
+
+	// then the frames outlive the age limit
+	time.Sleep(30 * time.Millisecond)
+	push(5, 12000, 0)
+	assert.Equal(t, []uint32{3000, 6000, 0, 9000}, evicted)
+
+	f, err := s.ReadFrame(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(12000), f.Timestamp())
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	assert.Equal(t, map[string]int{"evicted": 2, "stale": 2}, m.framesDropped)
+}
+
+func TestFramePayload(t *testing.T) {
+	q := NewFrameQueue()
+	f := NewFrame(nil)
+	f.Push(&Packet{Seq: 2, Timestamp: 3000, PT: 96, Payload: []byte{3, 4}, Marker: 1})
+	f.Push(&Packet{Seq: 1, Timestamp: 3000, PT: 96, Payload: []byte{1, 2}})
+	q.Push(f)
+
+	// every receive returns once complete
+	for i := 0; i < 2; i++ {
+		select {
+		case <-f.Done():
+		default:
+			t.Error("frame not done")
+		}
+	}
+
+	assert.Equal(t, 4, f.Len())
+	assert.Equal(t, []byte{1, 2, 3, 4}, f.Bytes())
+	assert.Equal(t, []byte{0, 1, 2, 3, 4}, f.AppendBytes([]byte{0}))
+	assert.Equal(t, byte(96), f.PayloadType())
+	assert.True(t, f.Marker())
+
+	var buf bytes.Buffer
+	n, err := f.WriteTo(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.Equal(t, []byte{1, 2, 3, 4}, buf.Bytes())
+
+	var seqs []uint16
+	for _, p := range f.Packets() {
+		seqs = append(seqs, p.Seq)
+	}
+	assert.Equal(t, []uint16{1, 2}, seqs)
+
+	first, last := f.ArrivalTime()
+	assert.False(t, first.IsZero())
+	assert.False(t, last.Before(first))
+
+	// known from the next frame
+	assert.Equal(t, time.Duration(0), f.Duration())
+	next := NewFrame(nil)
+	next.Push(&Packet{Seq: 3, Timestamp: 6000, Marker: 1})
+	q.Push(next)
+	assert.Equal(t, 3000*time.Second/90000, f.Duration())
+}
+
+func TestFrameChainBounded(t *testing.T) {
+	chain := func(f *Frame) int {
+		n := 0
+		for ; f != nil; f = f.prevFrame {
+			n += 1
+		}
+		return n
+	}
+
+	s := NewStream(1234, 20*time.Millisecond, nil).(*stream)
+	for i := 0; i < 1000; i++ {
+		s.dispatch(&Packet{Seq: uint16(i), Timestamp: uint32(i) * 3000, SSRC: 1234, Marker: 1, Payload: []byte{0}})
+		f, err := s.ReadFrame(context.Background())
+		assert.Nil(t, err)
+		f.Release()
+	}
+	assert.LessOrEqual(t, chain(s.currFrame), 2)
+
+	// the read frames still know where they end
+	s.dispatch(&Packet{Seq: 1000, Timestamp: 1000 * 3000, SSRC: 1234, Payload: []byte{0}})
+	s.dispatch(&Packet{Seq: 1002, Timestamp: 1000 * 3000, SSRC: 1234, Marker: 1, Payload: []byte{0}})
+	f, err := s.ReadFrame(context.Background())
+	assert.Equal(t, ErrFrameTimeout, err)
+	assert.Equal(t, []SeqRange{{1001, 1001}}, f.Missing())
+
+	// evicted frames are not kept by the ones queued after them
+	s = NewStream(1234, 20*time.Millisecond, nil, WithFrameLimits(1, 0, 0)).(*stream)
+	for i := 0; i < 1000; i++ {
+		s.dispatch(&Packet{Seq: uint16(i), Timestamp: uint32(i) * 3000, SSRC: 1234, Marker: 1, Payload: []byte{0}})
+	}
+	assert.LessOrEqual(t, chain(s.frameQueue.peek()), 2)
+}
+
+func TestFrameReorderedBoundary(t *testing.T) {
+	s := NewStream(1234, 20*time.Millisecond, nil, WithIncompletePolicy(IncompleteSkip))
+	push := func(seq uint16, ts uint32, marker byte) {
+		s.dispatch(&Packet{Seq: seq, Timestamp: ts, SSRC: 1234, Marker: marker, Payload: []byte{1}})
+	}
+
+	// the last packet of ts 2000 arrives after the next frame
+	push(10, 1000, 1)
+	push(11, 2000, 0)
+	push(13, 3000, 1)
+	push(12, 2000, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, ts := range []uint32{1000, 2000, 3000} {
+		f, err := s.ReadFrame(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, ts, f.Timestamp())
+		assert.Empty(t, f.Missing())
+	}
+}
@@ -0,0 +1,421 @@
+package rtp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const maxFrameSize = 0xffff
+
+var ErrFrameTooLarge = errors.New("packet too large for framing")
+
+// sizedReader is a packet transport telling the size of the next packet
+// before it is read
+type sizedReader interface {
+	nextPacketSize() (int, error)
+}
+
+/*
+	RFC 4571 framing
+
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |             LENGTH            |  RTP or RTCP packet ...       |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+// NewFramedConn wraps a byte stream such as net.TCPConn so that every Read
+// returns exactly one packet and every Write sends exactly one packet.
+func NewFramedConn(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+	return &framedConn{
+		rwc: rwc,
+		r:   bufio.NewReader(rwc),
+	}
+}
+
+type framedConn struct {
+	rwc  io.ReadWriteCloser
+	r    *bufio.Reader
+	wmu  sync.Mutex
+	wbuf []byte
+}
+
+func (fc *framedConn) Read(buf []byte) (int, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(fc.r, header[:]); err != nil {
+		return 0, err
+	}
+
+	return readFramePayload(fc.r, int(binary.BigEndian.Uint16(header[:])), buf)
+}
+
+func (fc *framedConn) Write(data []byte) (int, error) {
+	if len(data) > maxFrameSize {
+		return 0, ErrFrameTooLarge
+	}
+
+	fc.wmu.Lock()
+	defer fc.wmu.Unlock()
+
+	fc.wbuf = binary.BigEndian.AppendUint16(fc.wbuf[:0], uint16(len(data)))
+	fc.wbuf = append(fc.wbuf, data...)
+	if _, err := fc.rwc.Write(fc.wbuf); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (fc *framedConn) Close() error {
+	return fc.rwc.Close()
+}
+
+// nextPacketSize peeks at the length of the next frame
+func (fc *framedConn) nextPacketSize() (int, error) {
+	header, err := fc.r.Peek(2)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(header)), nil
+}
+
+// readFramePayload reads a frame of size n into buf, the frame is discarded
+// with io.ErrShortBuffer if buf can not hold it.
+func readFramePayload(r *bufio.Reader, n int, buf []byte) (int, error) {
+	if n > len(buf) {
+		if _, err := r.Discard(n); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrShortBuffer
+	}
+	return io.ReadFull(r, buf[:n])
+}
+
+/*
+	RTSP interleaved framing (RFC 2326 section 10.12)
+
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |      '$'      |    channel    |             length            |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                     RTP or RTCP packet ...                    |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+const interleavedMagic = '$'
+
+var ErrInterleaverClosed = errors.New("interleaver closed")
+
+// NewInterleaver demultiplexes an RTSP connection carrying '$' interleaved
+// data. Each channel is exposed as a packet oriented io.ReadWriteCloser, by
+// convention RTP uses an even channel and RTCP the following odd one. RTSP
+// messages found between interleaved frames are delivered on Messages, they
+// are queued until read. Packets of a channel whose reader is behind are
+// dropped.
+func NewInterleaver(rwc io.ReadWriteCloser) *Interleaver {
+	il := &Interleaver{
+		rwc:      rwc,
+		r:        bufio.NewReader(rwc),
+		channels: map[byte]*interleavedChannel{},
+		messages: make(chan []byte),
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go il.readPump()
+	go il.messagePump()
+	return il
+}
+
+type Interleaver struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+
+	// mutex guards channels, pending and err
+	mutex    sync.Mutex
+	channels map[byte]*interleavedChannel
+	messages chan []byte
+	pending  [][]byte
+	notify   chan struct{}
+
+	wmu  sync.Mutex
+	wbuf []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Channel returns the packet connection of the interleaved channel id.
+func (il *Interleaver) Channel(id byte) io.ReadWriteCloser {
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+
+	ch := il.channels[id]
+	if ch == nil {
+		ch = &interleavedChannel{
+			il:     il,
+			id:     id,
+			readCh: make(chan []byte, 100),
+			closed: make(chan struct{}),
+		}
+		il.channels[id] = ch
+	}
+	return ch
+}
+
+// Messages returns the RTSP messages received between interleaved frames.
+func (il *Interleaver) Messages() <-chan []byte {
+	return il.messages
+}
+
+func (il *Interleaver) Close() error {
+	var err error
+	il.closeOnce.Do(func() {
+		close(il.done)
+		err = il.rwc.Close()
+	})
+	return err
+}
+
+// fail records the error ending the read pump unless closed already, and
+// closes the Interleaver
+func (il *Interleaver) fail(err error) {
+	il.mutex.Lock()
+	select {
+	case <-il.done:
+	default:
+		il.err = err
+	}
+	il.mutex.Unlock()
+	il.Close()
+}
+
+func (il *Interleaver) readErr() error {
+	il.mutex.Lock()
+	defer il.mutex.Unlock()
+	return il.err
+}
+
+func (il *Interleaver) readPump() {
+	for {
+		magic, err := il.r.Peek(1)
+		if err != nil {
+			il.fail(err)
+			return
+		}
+
+		if magic[0] != interleavedMagic {
+			msg, err := readRTSPMessage(il.r)
+			if err != nil {
+				il.fail(err)
+				return
+			}
+
+			// control messages are never dropped
+			il.mutex.Lock()
+			il.pending = append(il.pending, msg)
+			il.mutex.Unlock()
+			select {
+			case il.notify <- struct{}{}:
+			default:
+			}
+			continue
+		}
+
+		var header [4]byte
+		if _, err := io.ReadFull(il.r, header[:]); err != nil {
+			il.fail(err)
+			return
+		}
+
+		size := int(binary.BigEndian.Uint16(header[2:]))
+		il.mutex.Lock()
+		ch := il.channels[header[1]]
+		il.mutex.Unlock()
+
+		if ch == nil {
+			if _, err := il.r.Discard(size); err != nil {
+				il.fail(err)
+				return
+			}
+			continue
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(il.r, data); err != nil {
+			il.fail(err)
+			return
+		}
+
+		select {
+		case ch.readCh <- data:
+		default:
+			// reader is behind, drop rather than stall the other channels
+		}
+	}
+}
+
+// messagePump delivers the queued RTSP messages in order
+func (il *Interleaver) messagePump() {
+	for {
+		select {
+		case <-il.notify:
+		case <-il.done:
+			return
+		}
+
+		for {
+			il.mutex.Lock()
+			if len(il.pending) == 0 {
+				il.mutex.Unlock()
+				break
+			}
+			msg := il.pending[0]
+			il.pending[0] = nil
+			il.pending = il.pending[1:]
+			il.mutex.Unlock()
+
+			select {
+			case il.messages <- msg:
+			case <-il.done:
+				return
+			}
+		}
+	}
+}
+
+func (il *Interleaver) write(id byte, data []byte) (int, error) {
+	if len(data) > maxFrameSize {
+		return 0, ErrFrameTooLarge
+	}
+
+	il.wmu.Lock()
+	defer il.wmu.Unlock()
+
+	il.wbuf = append(il.wbuf[:0], interleavedMagic, id)
+	il.wbuf = binary.BigEndian.AppendUint16(il.wbuf, uint16(len(data)))
+	il.wbuf = append(il.wbuf, data...)
+	if _, err := il.rwc.Write(il.wbuf); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// readRTSPMessage reads a RTSP request or response, including the body
+// announced by Content-Length.
+func readRTSPMessage(r *bufio.Reader) ([]byte, error) {
+	var (
+		msg    []byte
+		length int
+	)
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, line...)
+
+		field := strings.TrimSpace(string(line))
+		if field == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(field, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, errors.New("invalid rtsp content length")
+			}
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(msg, body...), nil
+}
+
+type interleavedChannel struct {
+	il        *Interleaver
+	id        byte
+	readCh    chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// next is the packet taken by nextPacketSize, it is returned by the
+	// following Read
+	next []byte
+}
+
+func (ch *interleavedChannel) Read(buf []byte) (int, error) {
+	data := ch.next
+	ch.next = nil
+	if data == nil {
+		var err error
+		if data, err = ch.receive(); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(data) > len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(buf, data), nil
+}
+
+// nextPacketSize waits for the next packet and returns its size
+func (ch *interleavedChannel) nextPacketSize() (int, error) {
+	if ch.next == nil {
+		data, err := ch.receive()
+		if err != nil {
+			return 0, err
+		}
+		ch.next = data
+	}
+	return len(ch.next), nil
+}
+
+func (ch *interleavedChannel) receive() ([]byte, error) {
+	select {
+	case data := <-ch.readCh:
+		return data, nil
+
+	case <-ch.closed:
+		return nil, ErrInterleaverClosed
+
+	case <-ch.il.done:
+		if err := ch.il.readErr(); err != nil {
+			return nil, err
+		}
+		return nil, ErrInterleaverClosed
+	}
+}
+
+func (ch *interleavedChannel) Write(data []byte) (int, error) {
+	select {
+	case <-ch.closed:
+		return 0, ErrInterleaverClosed
+	case <-ch.il.done:
+		return 0, ErrInterleaverClosed
+	default:
+	}
+	return ch.il.write(ch.id, data)
+}
+
+// Close detaches the channel, the underlying connection is closed with the
+// Interleaver.
+func (ch *interleavedChannel) Close() error {
+	ch.closeOnce.Do(func() {
+		close(ch.closed)
+		ch.il.mutex.Lock()
+		delete(ch.il.channels, ch.id)
+		ch.il.mutex.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,143 @@
+package rtp
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFramedConn(t *testing.T) {
+	a, b := net.Pipe()
+	fa, fb := NewFramedConn(a), NewFramedConn(b)
+	defer fa.Close()
+	defer fb.Close()
+
+	packets := [][]byte{
+		(&Packet{Seq: 1, Payload: []byte{1, 2, 3}}).Encode(),
+		(&Packet{Seq: 2, Payload: make([]byte, 2000)}).Encode(),
+		(&Packet{Seq: 3}).Encode(),
+	}
+
+	go func() {
+		for _, data := range packets {
+			fa.Write(data)
+		}
+	}()
+
+	buf := make([]byte, 1500)
+	n, err := fb.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, packets[0], buf[:n])
+
+	_, err = fb.Read(buf)
+	assert.ErrorIs(t, err, io.ErrShortBuffer)
+
+	n, err = fb.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, packets[2], buf[:n])
+}
+
+func TestInterleaver(t *testing.T) {
+	a, b := net.Pipe()
+	server := NewInterleaver(a)
+	defer server.Close()
+
+	rtpCh, rtcpCh := server.Channel(0), server.Channel(1)
+
+	go func() {
+		b.Write([]byte("RTSP/1.0 200 OK\r\nCSeq: 3\r\nContent-Length: 2\r\n\r\nok"))
+		b.Write([]byte{'$', 1, 0, 2, 0x81, 0xc9})
+		b.Write([]byte{'$', 0, 0, 3, 0x80, 0x60, 0x01})
+		b.Write([]byte{'$', 5, 0, 1, 0xff})
+	}()
+
+	buf := make([]byte, 1500)
+	n, err := rtcpCh.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x81, 0xc9}, buf[:n])
+
+	n, err = rtpCh.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x80, 0x60, 0x01}, buf[:n])
+
+	msg := <-server.Messages()
+	assert.Equal(t, "RTSP/1.0 200 OK\r\nCSeq: 3\r\nContent-Length: 2\r\n\r\nok", string(msg))
+
+	go rtpCh.Write([]byte{0x80})
+	header := make([]byte, 5)
+	_, err = io.ReadFull(b, header)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{'$', 0, 0, 1, 0x80}, header)
+}
+
+func TestFramedConnLarge(t *testing.T) {
+	a, b := net.Pipe()
+	c := NewConn(NewFramedConn(a), 50*time.Millisecond)
+	defer c.Close()
+	fb := NewFramedConn(b)
+	defer fb.Close()
+
+	// the receive buffer is of the size class of the packet
+	sizes := []int{1000, 4000, 20000}
+	buffers := []int{maxDatagramSize, jumboBufferSize, 20000 + 12}
+	go func() {
+		for i, size := range sizes {
+			p := &Packet{Seq: uint16(i + 1), Timestamp: uint32(i+1) * 3000, SSRC: 1234, Marker: 1, Payload: make([]byte, size)}
+			fb.Write(p.Encode())
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i, size := range sizes {
+		f, err := c.Stream(1234).ReadFrame(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, size, f.Len())
+		assert.Equal(t, buffers[i], len(f.First().buf.data))
+		f.Release()
+	}
+}
+
+func TestInterleaverSlowReader(t *testing.T) {
+	a, b := net.Pipe()
+	server := NewInterleaver(a)
+	defer server.Close()
+
+	rtpCh := server.Channel(0)
+	server.Channel(1)
+
+	go func() {
+		// nobody reads channel 1 nor the messages for a while
+		for i := 0; i < 200; i++ {
+			b.Write([]byte{'$', 1, 0, 1, byte(i)})
+		}
+		for i := 0; i < 20; i++ {
+			b.Write([]byte("RTSP/1.0 200 OK\r\nCSeq: " + strconv.Itoa(i) + "\r\n\r\n"))
+		}
+		b.Write([]byte{'$', 0, 0, 1, 0x80})
+	}()
+
+	buf := make([]byte, 1500)
+	n, err := rtpCh.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x80}, buf[:n])
+
+	for i := 0; i < 20; i++ {
+		msg := <-server.Messages()
+		assert.Contains(t, string(msg), "CSeq: "+strconv.Itoa(i)+"\r\n")
+	}
+
+	// a close racing the reads ends them
+	done := make(chan error)
+	go func() {
+		_, err := rtpCh.Read(buf)
+		done <- err
+	}()
+	go server.Close()
+	assert.NotNil(t, <-done)
+}
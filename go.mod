@@ -2,7 +2,11 @@ module github.com/yingshulu/rtp
 
 go 1.19
 
-require github.com/stretchr/testify v1.9.0
+require (
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/net v0.17.0
+	golang.org/x/sys v0.13.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -0,0 +1,80 @@
+package rtp
+
+// PacketHandler processes a RTP packet of a stream. A handler not passing
+// the packet on owns it and must Release it.
+type PacketHandler func(s Stream, p *Packet) error
+
+// RTCPHandler processes the packets of a compound RTCP packet
+type RTCPHandler func(pkts []RTCPPacket) error
+
+// Interceptor hooks into the packets of a Conn to observe, modify, drop or
+// inject them. Every method wrapping a handler is called once when the Conn
+// is created, the next handler may be kept to inject packets later.
+type Interceptor interface {
+	// BindStream is called when a stream is added to the Conn
+	BindStream(s Stream)
+
+	// UnbindStream is called when a stream is removed or the Conn closes
+	UnbindStream(s Stream)
+
+	// Inbound wraps the handler of received RTP packets
+	Inbound(next PacketHandler) PacketHandler
+
+	// Outbound wraps the handler of RTP packets to send
+	Outbound(next PacketHandler) PacketHandler
+
+	// InboundRTCP wraps the handler of received RTCP packets
+	InboundRTCP(next RTCPHandler) RTCPHandler
+
+	// OutboundRTCP wraps the handler of RTCP packets to send
+	OutboundRTCP(next RTCPHandler) RTCPHandler
+}
+
+// NoopInterceptor passes every packet on, embed it to implement only some
+// methods of Interceptor.
+type NoopInterceptor struct{}
+
+func (NoopInterceptor) BindStream(Stream) {}
+
+func (NoopInterceptor) UnbindStream(Stream) {}
+
+func (NoopInterceptor) Inbound(next PacketHandler) PacketHandler {
+	return next
+}
+
+func (NoopInterceptor) Outbound(next PacketHandler) PacketHandler {
+	return next
+}
+
+func (NoopInterceptor) InboundRTCP(next RTCPHandler) RTCPHandler {
+	return next
+}
+
+func (NoopInterceptor) OutboundRTCP(next RTCPHandler) RTCPHandler {
+	return next
+}
+
+// WithInterceptors appends interceptors to the chain of the Conn. Packets
+// pass the chain in order both ways, the first interceptor sees received
+// packets first and packets to send first.
+func WithInterceptors(interceptors ...Interceptor) ConnOption {
+	return func(c *conn) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// chain builds the packet handlers of the conn around its interceptors
+func (c *conn) chain() {
+	c.inbound = c.enqueue
+	c.outbound = c.writePacket
+	c.inboundRTCP = c.processRTCP
+	c.outboundRTCP = c.sendRTCP
+
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		ic := c.interceptors[i]
+		c.inbound = ic.Inbound(c.inbound)
+		c.outbound = ic.Outbound(c.outbound)
+		c.inboundRTCP = ic.InboundRTCP(c.inboundRTCP)
+		c.outboundRTCP = ic.OutboundRTCP(c.outboundRTCP)
+	}
+}
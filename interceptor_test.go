@@ -0,0 +1,103 @@
+package rtp
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordInterceptor struct {
+	NoopInterceptor
+	mutex    sync.Mutex
+	bound    []uint32
+	unbound  []uint32
+	inbound  []uint16
+	outbound []byte
+	rtcp     []RTCPPacket
+}
+
+func (ri *recordInterceptor) BindStream(s Stream) {
+	ri.mutex.Lock()
+	ri.bound = append(ri.bound, s.SSRC())
+	ri.mutex.Unlock()
+}
+
+func (ri *recordInterceptor) UnbindStream(s Stream) {
+	ri.mutex.Lock()
+	ri.unbound = append(ri.unbound, s.SSRC())
+	ri.mutex.Unlock()
+}
+
+func (ri *recordInterceptor) Inbound(next PacketHandler) PacketHandler {
+	return func(s Stream, p *Packet) error {
+		ri.mutex.Lock()
+		ri.inbound = append(ri.inbound, p.Seq)
+		ri.mutex.Unlock()
+
+		// drop the second packet
+		if p.Seq == 2 {
+			p.Release()
+			return nil
+		}
+		return next(s, p)
+	}
+}
+
+func (ri *recordInterceptor) Outbound(next PacketHandler) PacketHandler {
+	return func(s Stream, p *Packet) error {
+		ri.mutex.Lock()
+		ri.outbound = append(ri.outbound, p.PT)
+		ri.mutex.Unlock()
+		return next(s, p)
+	}
+}
+
+func (ri *recordInterceptor) InboundRTCP(next RTCPHandler) RTCPHandler {
+	return func(pkts []RTCPPacket) error {
+		ri.mutex.Lock()
+		ri.rtcp = append(ri.rtcp, pkts...)
+		ri.mutex.Unlock()
+		return next(pkts)
+	}
+}
+
+type payloadTypeInterceptor struct {
+	NoopInterceptor
+	pt byte
+}
+
+func (pi *payloadTypeInterceptor) Outbound(next PacketHandler) PacketHandler {
+	return func(s Stream, p *Packet) error {
+		p.PT = pi.pt
+		return next(s, p)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	dc := newDatagramConn()
+	ri := &recordInterceptor{}
+	c := NewConn(dc, 50*time.Millisecond, WithInterceptors(&payloadTypeInterceptor{pt: 100}, ri))
+
+	for i := 1; i <= 3; i++ {
+		p := &Packet{Seq: uint16(i), Timestamp: uint32(i * 3000), SSRC: 1234, Marker: 1, Payload: []byte{byte(i)}}
+		dc.readCh <- p.Encode()
+	}
+	dc.readCh <- EncodeRTCP(&ReceiverReport{SSRC: 5678})
+
+	_, err := c.Stream(4321).WriteFrame([]byte{1}, 96, 3000, nil)
+	assert.Nil(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+
+	ri.mutex.Lock()
+	defer ri.mutex.Unlock()
+	assert.ElementsMatch(t, []uint32{1234, 4321}, ri.bound)
+	assert.ElementsMatch(t, []uint32{1234, 4321}, ri.unbound)
+	assert.Equal(t, []uint16{1, 2, 3}, ri.inbound)
+	assert.Equal(t, []byte{100}, ri.outbound)
+	assert.Equal(t, 1, len(ri.rtcp))
+	assert.Equal(t, uint32(5678), ri.rtcp[0].(*ReceiverReport).SSRC)
+}
@@ -0,0 +1,76 @@
+package rtp
+
+import (
+	"sync"
+	"time"
+)
+
+// jitterDelayFactor scales the interarrival jitter into the target delay
+const jitterDelayFactor = 4
+
+// jitterBuffer schedules the playout of frames: the RTP timestamp is mapped
+// to local time by the earliest arrival seen and delayed by a multiple of
+// the jitter kept between min and max.
+type jitterBuffer struct {
+	mutex sync.Mutex
+	min   time.Duration
+	max   time.Duration
+	delay time.Duration
+
+	initialized bool
+	baseTS      uint32
+	base        time.Time
+}
+
+func newJitterBuffer(min, max time.Duration) *jitterBuffer {
+	if max < min {
+		max = min
+	}
+	return &jitterBuffer{
+		min:   min,
+		max:   max,
+		delay: min,
+	}
+}
+
+// schedule returns the playout time of the frame of timestamp ts whose first
+// packet arrived at arrival, jitter is in seconds.
+func (jb *jitterBuffer) schedule(ts uint32, arrival time.Time, jitter float64, clockRate uint32) time.Time {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+
+	if !jb.initialized {
+		jb.initialized = true
+		jb.baseTS = ts
+		jb.base = arrival
+	}
+
+	offset := time.Duration(int64(int32(ts-jb.baseTS)) * int64(time.Second) / int64(clockRate))
+
+	// the least delayed frame gives the mapping, later ones add jitter
+	if start := arrival.Add(-offset); start.Before(jb.base) {
+		jb.base = start
+	}
+
+	target := time.Duration(jitter * jitterDelayFactor * float64(time.Second))
+	if target < jb.min {
+		target = jb.min
+	} else if target > jb.max {
+		target = jb.max
+	}
+
+	// grow at once to stop late frames, shrink slowly to avoid gaps
+	if target > jb.delay {
+		jb.delay = target
+	} else {
+		jb.delay -= (jb.delay - target) / 16
+	}
+
+	return jb.base.Add(offset + jb.delay)
+}
+
+func (jb *jitterBuffer) current() time.Duration {
+	jb.mutex.Lock()
+	defer jb.mutex.Unlock()
+	return jb.delay
+}
@@ -0,0 +1,92 @@
+package rtp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitterBuffer(t *testing.T) {
+	jb := newJitterBuffer(20*time.Millisecond, 100*time.Millisecond)
+	start := time.Now()
+
+	// mapped by the earliest arrival, delayed by min
+	assert.Equal(t, start.Add(20*time.Millisecond), jb.schedule(0, start, 0, 90000))
+	assert.Equal(t, start.Add(60*time.Millisecond), jb.schedule(3600, start.Add(55*time.Millisecond), 0, 90000))
+	assert.Equal(t, start.Add(30*time.Millisecond), jb.schedule(2700, start.Add(10*time.Millisecond), 0, 90000))
+
+	// grows with the jitter up to max, shrinks slowly
+	jb.schedule(3600, start, 0.01, 90000)
+	assert.Equal(t, 40*time.Millisecond, jb.current())
+	jb.schedule(3600, start, 1, 90000)
+	assert.Equal(t, 100*time.Millisecond, jb.current())
+	jb.schedule(3600, start, 0, 90000)
+	assert.Equal(t, 95*time.Millisecond, jb.current())
+}
+
+func TestJitterBufferPlayout(t *testing.T) {
+	m := &countMetrics{}
+	s := NewStream(1234, 20*time.Millisecond, nil, WithJitterBuffer(50*time.Millisecond, 200*time.Millisecond), withStreamMetrics(m))
+	assert.Equal(t, 50*time.Millisecond, s.PlayoutDelay())
+
+	frame := func(seq uint16, ts uint32) {
+		assert.Nil(t, s.dispatch(&Packet{Seq: seq, Timestamp: ts, SSRC: 1234, Marker: 1, Payload: []byte{1}}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	frame(1, 0)
+	f, err := s.ReadFrame(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), f.Timestamp())
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// due 60ms after the first frame
+	time.Sleep(100 * time.Millisecond)
+	frame(2, 900)
+	frame(3, 18000)
+	f, err = s.ReadFrame(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(18000), f.Timestamp())
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	assert.Equal(t, map[string]int{"late": 1}, m.framesDropped)
+}
+
+func TestJitterBufferIncomplete(t *testing.T) {
+	m := &countMetrics{}
+	s := NewStream(1234, time.Second, nil,
+		WithJitterBuffer(50*time.Millisecond, 200*time.Millisecond),
+		WithIncompletePolicy(IncompletePartial),
+		withStreamMetrics(m))
+
+	// the first frame misses its marker
+	assert.Nil(t, s.dispatch(&Packet{Seq: 1, Timestamp: 0, SSRC: 1234, Payload: []byte{1}}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// settled at the playout time instead of the read timeout
+	start := time.Now()
+	f, err := s.ReadFrame(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), f.Timestamp())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	f.Release()
+
+	// due 100ms after the first frame, it is not held up by it
+	assert.Nil(t, s.dispatch(&Packet{Seq: 2, Timestamp: 9000, SSRC: 1234, Marker: 1, Payload: []byte{2}}))
+	f, err = s.ReadFrame(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(9000), f.Timestamp())
+	f.Release()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	assert.Empty(t, m.framesDropped)
+}
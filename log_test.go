@@ -0,0 +1,67 @@
+package rtp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordLogger keeps the events at Info and above as formatted lines
+type recordLogger struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (rl *recordLogger) record(level, msg string, args ...any) {
+	line := fmt.Sprintf("level=%s msg=%q", level, msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		line += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+
+	rl.mutex.Lock()
+	rl.events = append(rl.events, line)
+	rl.mutex.Unlock()
+}
+
+func (rl *recordLogger) Debug(msg string, args ...any) {}
+
+func (rl *recordLogger) Info(msg string, args ...any) {
+	rl.record("INFO", msg, args...)
+}
+
+func (rl *recordLogger) Warn(msg string, args ...any) {
+	rl.record("WARN", msg, args...)
+}
+
+func (rl *recordLogger) Error(msg string, args ...any) {
+	rl.record("ERROR", msg, args...)
+}
+
+func TestLogger(t *testing.T) {
+	logger := &recordLogger{}
+
+	dc := newDatagramConn()
+	c := NewConn(dc, time.Second, WithLogger(logger))
+
+	dc.readCh <- []byte{0x80, 0x60}
+	dc.readCh <- (&Packet{Seq: 1, SSRC: 1234, Payload: []byte{1}}).Encode()
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	assert.Contains(t, logger.events, `level=WARN msg="packet parse failed" err=rtp: short packet at offset 2`)
+	assert.Contains(t, logger.events, `level=INFO msg="stream created" ssrc=1234`)
+
+	closed := false
+	for _, e := range logger.events {
+		if strings.HasPrefix(e, `level=INFO msg="conn closed"`) {
+			closed = true
+		}
+	}
+	assert.True(t, closed)
+}
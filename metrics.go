@@ -0,0 +1,40 @@
+package rtp
+
+// Metrics receives the counters of a Conn and its streams
+type Metrics interface {
+	PacketReceived(ssrc uint32, size int)
+	PacketSent(ssrc uint32, size int)
+	ParseError()
+
+	// DispatchDenied counts a packet refused by its frame, reason is a
+	// Deny code such as DenyFrameFull
+	DispatchDenied(ssrc uint32, reason int)
+	FrameCompleted(ssrc uint32)
+	FrameTimedOut(ssrc uint32)
+
+	// PacketDropped counts a packet dropped by the policy of a full
+	// queue, queue is "write", "dispatch" or "read"
+	PacketDropped(ssrc uint32, queue string)
+
+	// FrameDropped counts a received frame dropped before reading, reason
+	// is "late" for a frame past its playout time
+	FrameDropped(ssrc uint32, reason string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) PacketReceived(uint32, int) {}
+
+func (nopMetrics) PacketSent(uint32, int) {}
+
+func (nopMetrics) ParseError() {}
+
+func (nopMetrics) DispatchDenied(uint32, int) {}
+
+func (nopMetrics) FrameCompleted(uint32) {}
+
+func (nopMetrics) FrameTimedOut(uint32) {}
+
+func (nopMetrics) PacketDropped(uint32, string) {}
+
+func (nopMetrics) FrameDropped(uint32, string) {}
@@ -0,0 +1,181 @@
+package rtp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// MulticastConfig contains options for joining a multicast RTP session
+type MulticastConfig struct {
+	// Interface to join the group on, nil means the system default
+	Interface *net.Interface
+
+	// Sources restricts the group to these senders (SSM, RFC 4607), empty
+	// means any-source multicast
+	Sources []net.IP
+
+	// TTL is the IPv4 TTL or IPv6 hop limit of sent packets, 0 means the
+	// system default of 1
+	TTL int
+
+	// Loopback delivers packets sent by this host to local members
+	Loopback bool
+
+	// Timeout is the frame read timeout of the Conn
+	Timeout time.Duration
+
+	// RTCPMux multiplexes RTCP on the RTP port, otherwise RTCP uses the
+	// next port
+	RTCPMux bool
+
+	// Bandwidth is the session bandwidth in bits per second, the RTCP report
+	// interval is scaled so that all members share 5% of it
+	Bandwidth int
+
+	// Options configure the Conn, such as WithInterceptors
+	Options []ConnOption
+}
+
+// ListenMulticast joins the any-source multicast group at address
+func ListenMulticast(network, address string) (Conn, error) {
+	var mc MulticastConfig
+	return mc.Listen(network, address)
+}
+
+// Listen joins the multicast group at address, packets written to the Conn
+// are sent to the group and every sender is a Stream by its SSRC.
+func (mc *MulticastConfig) Listen(network, address string) (Conn, error) {
+	group, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !group.IP.IsMulticast() {
+		return nil, errors.New("not a multicast address")
+	}
+
+	rtpConn, err := mc.join(group)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newConn(rtpConn, mc.Timeout, mc.Options...)
+	if mc.RTCPMux {
+		c.enableRTCP(nil, mc.Bandwidth)
+	} else {
+		rtcpConn, err := mc.join(&net.UDPAddr{IP: group.IP, Port: group.Port + 1, Zone: group.Zone})
+		if err != nil {
+			rtpConn.Close()
+			return nil, err
+		}
+		c.enableRTCP(rtcpConn, mc.Bandwidth)
+	}
+
+	c.start()
+	return c, nil
+}
+
+type groupConn interface {
+	JoinGroup(ifi *net.Interface, group net.Addr) error
+	JoinSourceSpecificGroup(ifi *net.Interface, group, source net.Addr) error
+	SetMulticastInterface(ifi *net.Interface) error
+	SetMulticastLoopback(on bool) error
+}
+
+func (mc *MulticastConfig) join(group *net.UDPAddr) (*multicastConn, error) {
+	network := "udp6"
+	if group.IP.To4() != nil {
+		network = "udp4"
+	}
+
+	lc := net.ListenConfig{Control: reuseAddr}
+	pc, err := lc.ListenPacket(context.Background(), network, net.JoinHostPort("", strconv.Itoa(group.Port)))
+	if err != nil {
+		return nil, err
+	}
+
+	var gc groupConn
+	if network == "udp4" {
+		p := ipv4.NewPacketConn(pc)
+		if mc.TTL > 0 {
+			err = p.SetMulticastTTL(mc.TTL)
+		}
+		gc = p
+	} else {
+		p := ipv6.NewPacketConn(pc)
+		if mc.TTL > 0 {
+			err = p.SetMulticastHopLimit(mc.TTL)
+		}
+		gc = p
+	}
+
+	if err == nil && mc.Interface != nil {
+		err = gc.SetMulticastInterface(mc.Interface)
+	}
+
+	if err == nil {
+		err = gc.SetMulticastLoopback(mc.Loopback)
+	}
+
+	if err == nil {
+		err = joinGroup(gc, mc.Interface, group.IP, mc.Sources)
+	}
+
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	return &multicastConn{
+		PacketConn: pc,
+		group:      group,
+	}, nil
+}
+
+func joinGroup(gc groupConn, ifi *net.Interface, group net.IP, sources []net.IP) error {
+	if len(sources) == 0 {
+		return gc.JoinGroup(ifi, &net.UDPAddr{IP: group})
+	}
+
+	for _, source := range sources {
+		err := gc.JoinSourceSpecificGroup(ifi, &net.UDPAddr{IP: group}, &net.UDPAddr{IP: source})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multicastConn receives from and sends to a multicast group, the group
+// membership ends with the socket.
+type multicastConn struct {
+	net.PacketConn
+	group *net.UDPAddr
+
+	// source of the last packet read
+	source net.Addr
+}
+
+func (mc *multicastConn) Read(buf []byte) (int, error) {
+	n, addr, err := mc.ReadFrom(buf)
+	mc.source = addr
+	return n, err
+}
+
+func (mc *multicastConn) sourceAddr() net.Addr {
+	return mc.source
+}
+
+func (mc *multicastConn) Write(data []byte) (int, error) {
+	return mc.WriteTo(data, mc.group)
+}
+
+func (mc *multicastConn) RemoteAddr() net.Addr {
+	return mc.group
+}
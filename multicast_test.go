@@ -0,0 +1,42 @@
+package rtp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMulticast(t *testing.T) {
+	mc := MulticastConfig{
+		Timeout:  time.Second,
+		Loopback: true,
+		TTL:      1,
+	}
+
+	receiver, err := mc.Listen("udp", "239.255.42.1:15004")
+	if err != nil {
+		t.Skip("multicast unavailable: ", err)
+	}
+	defer receiver.Close()
+
+	sender, err := mc.Listen("udp", "239.255.42.1:15004")
+	assert.Nil(t, err)
+	defer sender.Close()
+
+	s1, s2 := sender.Stream(1111), sender.Stream(2222)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for _, s := range []Stream{s1, s2} {
+		_, err = s.WriteFrame([]byte{1, 2, 3}, 96, 3000, nil)
+		assert.Nil(t, err)
+
+		f, _ := receiver.Stream(s.SSRC()).ReadFrame(ctx)
+		if f == nil {
+			t.Skip("multicast loopback unavailable")
+		}
+		assert.Equal(t, s.SSRC(), f.First().SSRC)
+	}
+}
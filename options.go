@@ -0,0 +1,252 @@
+package rtp
+
+import "time"
+
+// ConnOption configures a Conn
+type ConnOption func(c *conn)
+
+// WithWriteQueue sets the number of packets queued for sending, 100 by
+// default
+func WithWriteQueue(depth int) ConnOption {
+	return func(c *conn) {
+		c.writeDepth = depth
+	}
+}
+
+// WithDispatchQueue sets the number of received packets queued per stream,
+// 100 by default
+func WithDispatchQueue(depth int) ConnOption {
+	return func(c *conn) {
+		c.dispatchDepth = depth
+	}
+}
+
+// WithWritePolicy sets what a write does on a full write queue, QueueBlock
+// by default
+func WithWritePolicy(policy QueuePolicy) ConnOption {
+	return func(c *conn) {
+		c.writePolicy = policy
+	}
+}
+
+// WithDispatchPolicy sets what the receive path does on the full dispatch
+// queue of a stream, QueueDropOldest by default. QueueBlock stalls the
+// receive path of every stream behind a slow reader or handler.
+func WithDispatchPolicy(policy QueuePolicy) ConnOption {
+	return func(c *conn) {
+		c.dispatchPolicy = policy
+	}
+}
+
+// WithKeyFrame tells the packets of key frames for QueueDropFrame and
+// IncompleteSkipToKey, such as an IDR slice for H.264
+func WithKeyFrame(keyFrame func(p *Packet) bool) ConnOption {
+	return func(c *conn) {
+		c.keyFrame = keyFrame
+	}
+}
+
+// WithParseMode sets how received packets are validated, Lenient by default
+func WithParseMode(mode ParseMode) ConnOption {
+	return func(c *conn) {
+		c.parseMode = mode
+	}
+}
+
+// WithLogger sets the logger of the Conn and its streams, events are
+// dropped by default. A nil logger is ignored.
+func WithLogger(logger Logger) ConnOption {
+	return func(c *conn) {
+		if logger != nil {
+			c.log = logger
+		}
+	}
+}
+
+// WithMetrics sets the sink of the Conn counters, a nil sink is ignored
+func WithMetrics(metrics Metrics) ConnOption {
+	return func(c *conn) {
+		if metrics != nil {
+			c.metrics = metrics
+		}
+	}
+}
+
+// WithClosePolicy sets what Close does with the queued packets,
+// CloseDiscard by default
+func WithClosePolicy(policy ClosePolicy) ConnOption {
+	return func(c *conn) {
+		c.policy = policy
+	}
+}
+
+// WithAccept sets a function deciding on the first packet of an unknown
+// SSRC whether to create its stream, such as to allow-list SSRCs or payload
+// types. Refused packets are dropped. Every SSRC is accepted by default.
+func WithAccept(accept func(p *Packet) bool) ConnOption {
+	return func(c *conn) {
+		c.accept = accept
+	}
+}
+
+// WithInactivityTimeout removes the streams without a packet received or
+// sent for timeout, streams are kept by default
+func WithInactivityTimeout(timeout time.Duration) ConnOption {
+	return func(c *conn) {
+		c.inactivity = timeout
+	}
+}
+
+// WithStreamOptions applies opts to every stream of the Conn
+func WithStreamOptions(opts ...StreamOption) ConnOption {
+	return func(c *conn) {
+		c.streamOpts = append(c.streamOpts, opts...)
+	}
+}
+
+// StreamOption configures a Stream
+type StreamOption func(s *stream)
+
+// WithReadTimeout sets how long ReadFrame waits for an incomplete frame
+func WithReadTimeout(timeout time.Duration) StreamOption {
+	return func(s *stream) {
+		s.timeout = timeout
+	}
+}
+
+// WithMTU sets the maximum payload size of a sent packet, MTU by default.
+// A size below 1 is ignored.
+func WithMTU(mtu int) StreamOption {
+	return func(s *stream) {
+		if mtu > 0 {
+			s.mtu = mtu
+		}
+	}
+}
+
+// WithSequencer sets the sequence numbers of sent packets, a random start
+// by default. A nil sequencer is ignored.
+func WithSequencer(sequencer Sequencer) StreamOption {
+	return func(s *stream) {
+		if sequencer != nil {
+			s.sequencer = sequencer
+		}
+	}
+}
+
+// WithInitialSequence sets the sequence number of the first sent packet
+func WithInitialSequence(seq uint16) StreamOption {
+	return func(s *stream) {
+		s.sequencer = NewSequencer(seq)
+	}
+}
+
+// WithInitialTimestamp sets the timestamp of the first sent frame, 0 by
+// default
+func WithInitialTimestamp(timestamp uint32) StreamOption {
+	return func(s *stream) {
+		s.timestamp = timestamp
+	}
+}
+
+// WithClockRate sets the RTP clock rate of the payload in Hz, used for
+// jitter and sender reports, 90000 by default
+func WithClockRate(rate uint32) StreamOption {
+	return func(s *stream) {
+		s.recv.clockRate = rate
+		s.send.clockRate = rate
+	}
+}
+
+// WithFrameMode sets how received packets are assembled into frames
+func WithFrameMode(mode FrameMode) StreamOption {
+	return func(s *stream) {
+		s.frameMode = mode
+	}
+}
+
+// WithReadQueue sets the number of frames of FramePacket, or packets of
+// FrameNone, waiting for ReadFrame or ReadPacket, 100 by default. Received
+// ones past it are dropped. A depth below 1 is ignored.
+func WithReadQueue(depth int) StreamOption {
+	return func(s *stream) {
+		if depth > 0 {
+			s.readDepth = depth
+		}
+	}
+}
+
+// WithJitterBuffer makes ReadFrame return frames at their playout time: the
+// RTP timestamp mapped to local time plus a delay adapting to the jitter
+// between min and max. Frames past their playout time are dropped, frames
+// still incomplete at it are handled by the IncompletePolicy. It only
+// applies to FrameMarker.
+func WithJitterBuffer(min, max time.Duration) StreamOption {
+	return func(s *stream) {
+		s.jitter = newJitterBuffer(min, max)
+	}
+}
+
+// WithReorderWindow makes ReadPacket return packets in sequence order with
+// FrameNone, holding up to window packets or the read timeout for a missing
+// one. 0, the default, keeps the arrival order.
+func WithReorderWindow(window int) StreamOption {
+	return func(s *stream) {
+		s.window = window
+	}
+}
+
+// WithRewrite makes WritePacket replace the sequence numbers with those of
+// the stream, and shift the timestamps to start at the stream timestamp
+func WithRewrite(seq, timestamp bool) StreamOption {
+	return func(s *stream) {
+		s.rewriteSeq = seq
+		s.rewriteTS = timestamp
+	}
+}
+
+// WithIncompletePolicy sets what ReadFrame does with a frame still
+// incomplete after the read timeout, IncompleteWait by default
+func WithIncompletePolicy(policy IncompletePolicy) StreamOption {
+	return func(s *stream) {
+		s.incomplete = policy
+	}
+}
+
+// WithFrameLimits bounds the received frames waiting for ReadFrame by
+// count, payload bytes and age, 0 is unlimited. Frames older than age are
+// dropped as "stale", then the oldest frames preferring non key frames as
+// "evicted". Limits are enforced as packets arrive.
+func WithFrameLimits(frames, bytes int, age time.Duration) StreamOption {
+	return func(s *stream) {
+		s.maxFrames = frames
+		s.maxBytes = bytes
+		s.maxAge = age
+	}
+}
+
+// WithEvictHandler sets a function called with every frame dropped by
+// WithFrameLimits before it is released
+func WithEvictHandler(handler func(f *Frame, reason string)) StreamOption {
+	return func(s *stream) {
+		s.evicted = handler
+	}
+}
+
+func withStreamKeyFrame(keyFrame func(p *Packet) bool) StreamOption {
+	return func(s *stream) {
+		s.keyFrame = keyFrame
+	}
+}
+
+func withStreamLogger(logger Logger) StreamOption {
+	return func(s *stream) {
+		s.log = logger
+	}
+}
+
+func withStreamMetrics(metrics Metrics) StreamOption {
+	return func(s *stream) {
+		s.metrics = metrics
+	}
+}
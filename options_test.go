@@ -0,0 +1,149 @@
+package rtp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countMetrics struct {
+	nopMetrics
+	mutex    sync.Mutex
+	received int
+	parse    int
+	frames   int
+
+	framesDropped  map[string]int
+	packetsDropped map[string]int
+}
+
+func (cm *countMetrics) PacketReceived(uint32, int) {
+	cm.mutex.Lock()
+	cm.received += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *countMetrics) ParseError() {
+	cm.mutex.Lock()
+	cm.parse += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *countMetrics) FrameCompleted(uint32) {
+	cm.mutex.Lock()
+	cm.frames += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *countMetrics) PacketDropped(_ uint32, queue string) {
+	cm.mutex.Lock()
+	if cm.packetsDropped == nil {
+		cm.packetsDropped = map[string]int{}
+	}
+	cm.packetsDropped[queue] += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *countMetrics) FrameDropped(_ uint32, reason string) {
+	cm.mutex.Lock()
+	if cm.framesDropped == nil {
+		cm.framesDropped = map[string]int{}
+	}
+	cm.framesDropped[reason] += 1
+	cm.mutex.Unlock()
+}
+
+func TestStreamOptions(t *testing.T) {
+	var sent []*Packet
+	s := NewStream(1234, time.Second, func(p *Packet) error {
+		sent = append(sent, p)
+		return nil
+	}, WithMTU(2), WithInitialSequence(65535), WithInitialTimestamp(500))
+
+	n, err := s.WriteFrame([]byte{1, 2, 3, 4, 5}, 96, 3000, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, 3, len(sent))
+	for i, seq := range []uint16{65535, 0, 1} {
+		assert.Equal(t, seq, sent[i].Seq)
+		assert.Equal(t, uint32(500), sent[i].Timestamp)
+	}
+	assert.Equal(t, byte(1), sent[2].Marker)
+
+	// an empty MTU keeps the default instead of never ending the frame
+	for _, mtu := range []int{0, -1} {
+		sent = nil
+		s = NewStream(1234, time.Second, func(p *Packet) error {
+			sent = append(sent, p)
+			return nil
+		}, WithMTU(mtu))
+		n, err = s.WriteFrame(make([]byte, MTU+1), 96, 3000, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, MTU+1, n)
+		assert.Equal(t, 2, len(sent))
+	}
+
+	// a nil sequencer keeps the default
+	s = NewStream(1234, time.Second, func(p *Packet) error {
+		return nil
+	}, WithSequencer(nil))
+	_, err = s.WriteFrame([]byte{1}, 96, 3000, nil)
+	assert.Nil(t, err)
+
+	// the frames past the read queue are dropped
+	m := &countMetrics{}
+	s = NewStream(1234, time.Second, nil, WithFrameMode(FramePacket), WithReadQueue(2), withStreamMetrics(m))
+	for i := 1; i <= 3; i++ {
+		assert.Nil(t, s.dispatch(&Packet{Seq: uint16(i), Timestamp: uint32(i) * 160, SSRC: 1234, Payload: []byte{1}}))
+	}
+	assert.Equal(t, map[string]int{"read": 1}, m.packetsDropped)
+}
+
+func TestConnOptions(t *testing.T) {
+	dc := newDatagramConn()
+	cm := &countMetrics{}
+	c := NewConn(dc, time.Second,
+		WithMetrics(cm),
+		WithParseMode(Strict),
+		WithDispatchQueue(4),
+		WithStreamOptions(WithFrameMode(FramePacket)))
+	defer c.Close()
+
+	bad := (&Packet{SSRC: 1234, Payload: []byte{1}}).Encode()
+	bad[0] = 1 << 6
+	dc.readCh <- bad
+
+	// packets of a timestamp without marker are frames of their own
+	for i := 1; i <= 2; i++ {
+		p := &Packet{Seq: uint16(i), Timestamp: 3000, SSRC: 1234, Payload: []byte{byte(i)}}
+		dc.readCh <- p.Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 1; i <= 2; i++ {
+		f, err := c.Stream(1234).ReadFrame(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{byte(i)}, f.First().Payload)
+		f.Release()
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	assert.Equal(t, 1, cm.parse)
+	assert.Equal(t, 2, cm.received)
+	assert.Equal(t, 2, cm.frames)
+
+	// nil options keep the defaults
+	dc = newDatagramConn()
+	c = NewConn(dc, time.Second, WithLogger(nil), WithMetrics(nil))
+	defer c.Close()
+	dc.readCh <- []byte{0x80, 0x60}
+	dc.readCh <- (&Packet{Seq: 1, Timestamp: 3000, SSRC: 1234, Marker: 1, Payload: []byte{1}}).Encode()
+	f, err := c.Stream(1234).ReadFrame(ctx)
+	assert.Nil(t, err)
+	f.Release()
+}
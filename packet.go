@@ -1,8 +1,12 @@
 package rtp
 
 import (
+	"context"
+	"encoding"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 )
 
 const FixedHeaderSize = 12
@@ -34,13 +38,27 @@ func (e *Extension) Count() int {
 }
 
 func (e *Extension) Encode() []byte {
-	size := 4*int(e.Length) + 4
-	data := make([]byte, 0, size)
+	data := make([]byte, e.MarshalSize())
+	n, _ := e.MarshalTo(data)
+	return data[:n]
+}
+
+// MarshalSize returns the encoded size of the extension
+func (e *Extension) MarshalSize() int {
+	return 4 + len(e.HeaderExtensions)
+}
+
+// MarshalTo encodes the extension into buf and returns the encoded size
+func (e *Extension) MarshalTo(buf []byte) (int, error) {
+	size := e.MarshalSize()
+	if len(buf) < size {
+		return 0, io.ErrShortBuffer
+	}
 
-	data = binary.BigEndian.AppendUint16(data, e.Profile)
-	data = binary.BigEndian.AppendUint16(data, e.Length)
-	data = append(data, e.HeaderExtensions...)
-	return data
+	binary.BigEndian.PutUint16(buf, e.Profile)
+	binary.BigEndian.PutUint16(buf[2:], e.Length)
+	copy(buf[4:], e.HeaderExtensions)
+	return size, nil
 }
 
 func (e *Extension) Decode(data []byte) int {
@@ -76,6 +94,11 @@ func (e *Extension) Decode(data []byte) int {
    +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 */
 
+var (
+	_ encoding.BinaryMarshaler   = (*Packet)(nil)
+	_ encoding.BinaryUnmarshaler = (*Packet)(nil)
+)
+
 type Packet struct {
 	V         byte
 	P         byte
@@ -89,6 +112,15 @@ type Packet struct {
 	CSRC      []uint32
 	Extension *Extension
 	Payload   []byte
+
+	// PaddingSize is the number of padding octets after the payload,
+	// including the trailing count octet
+	PaddingSize byte
+
+	buf *packetBuffer
+
+	// ctx bounds the wait of a sent packet for room in the write queue
+	ctx context.Context
 }
 
 func (f *Packet) Encode() []byte {
@@ -96,40 +128,131 @@ func (f *Packet) Encode() []byte {
 	if f.Extension != nil {
 		f.X = byte(1)
 	}
+	if f.PaddingSize > 0 {
+		f.P = byte(1)
+	}
 	f.CC = byte(len(f.CSRC))
 
-	size := FixedHeaderSize + 4*len(f.CSRC) + len(f.Payload)
+	data := make([]byte, f.MarshalSize())
+	n, _ := f.MarshalTo(data)
+	return data[:n]
+}
+
+// MarshalSize returns the encoded size of the packet
+func (f *Packet) MarshalSize() int {
+	size := FixedHeaderSize + 4*len(f.CSRC) + len(f.Payload) + int(f.PaddingSize)
 	if f.Extension != nil {
-		size += f.Extension.Count()
+		size += f.Extension.MarshalSize()
 	}
+	return size
+}
 
-	data := make([]byte, 0, size)
-
-	firstByte := f.V<<6 | f.P<<5 | f.X<<4 | f.CC
-	data = append(data, firstByte)
+// MarshalTo encodes the packet into buf without allocating and returns the
+// encoded size. Version, padding and extension bits and CSRC count follow
+// the fields.
+func (f *Packet) MarshalTo(buf []byte) (int, error) {
+	size := f.MarshalSize()
+	if len(buf) < size {
+		return 0, io.ErrShortBuffer
+	}
 
-	secondByte := f.Marker<<7 | f.PT
-	data = append(data, secondByte)
+	var p, x byte
+	if f.PaddingSize > 0 {
+		p = 1
+	}
+	if f.Extension != nil {
+		x = 1
+	}
 
-	data = binary.BigEndian.AppendUint16(data, f.Seq)
-	data = binary.BigEndian.AppendUint32(data, f.Timestamp)
-	data = binary.BigEndian.AppendUint32(data, f.SSRC)
+	buf[0] = 2<<6 | p<<5 | x<<4 | byte(len(f.CSRC))
+	buf[1] = f.Marker<<7 | f.PT
+	binary.BigEndian.PutUint16(buf[2:], f.Seq)
+	binary.BigEndian.PutUint32(buf[4:], f.Timestamp)
+	binary.BigEndian.PutUint32(buf[8:], f.SSRC)
 
+	index := FixedHeaderSize
 	for _, c := range f.CSRC {
-		data = binary.BigEndian.AppendUint32(data, c)
+		binary.BigEndian.PutUint32(buf[index:], c)
+		index += 4
 	}
 
 	if f.Extension != nil {
-		data = append(data, f.Extension.Encode()...)
+		n, err := f.Extension.MarshalTo(buf[index:])
+		if err != nil {
+			return 0, err
+		}
+		index += n
 	}
 
-	data = append(data, f.Payload...)
-	return data
+	index += copy(buf[index:], f.Payload)
+	if f.PaddingSize > 0 {
+		end := index + int(f.PaddingSize) - 1
+		for ; index < end; index++ {
+			buf[index] = 0
+		}
+		buf[index] = f.PaddingSize
+		index += 1
+	}
+	return index, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (f *Packet) MarshalBinary() ([]byte, error) {
+	return f.Encode(), nil
 }
 
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, the packet keeps a
+// copy of data.
+func (f *Packet) UnmarshalBinary(data []byte) error {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	return f.Parse(buf, Lenient)
+}
+
+// UnmarshalHeader decodes the fixed header, CSRC list and extension of data
+// and returns the header size, the payload is left untouched. The CSRC
+// slice of the packet is reused when large enough.
+func (f *Packet) UnmarshalHeader(data []byte) (int, error) {
+	return f.parseHeader(data, Lenient)
+}
+
+// Decode parses data leniently and returns its size, or Lack and Illegal
+// on failure. Use Parse to get the reason.
 func (f *Packet) Decode(data []byte) int {
+	if err := f.Parse(data, Lenient); err != nil {
+		return errorCode(err)
+	}
+	return len(data)
+}
+
+// Parse decodes data into the packet, payload and extension alias data.
+// Failures are *ParseError values wrapping ErrShortPacket, ErrBadVersion,
+// ErrBadPadding or ErrExtensionTruncated.
+func (f *Packet) Parse(data []byte, mode ParseMode) error {
+	index, err := f.parseHeader(data, mode)
+	if err != nil {
+		return err
+	}
+
+	end := len(data)
+	f.PaddingSize = 0
+	if f.P == 1 {
+		// the count includes itself, zero is tolerated as no padding
+		count := int(data[end-1])
+		if count > end-index || count == 0 && mode == Strict {
+			return &ParseError{Offset: end - 1, Err: ErrBadPadding}
+		}
+		end -= count
+		f.PaddingSize = byte(count)
+	}
+
+	f.Payload = data[index:end]
+	return nil
+}
+
+func (f *Packet) parseHeader(data []byte, mode ParseMode) (int, error) {
 	if len(data) < FixedHeaderSize {
-		return Lack
+		return 0, &ParseError{Offset: len(data), Err: ErrShortPacket}
 	}
 
 	firstByte := data[0]
@@ -138,6 +261,10 @@ func (f *Packet) Decode(data []byte) int {
 	f.X = (firstByte & 0x10) >> 4
 	f.CC = firstByte & 0x0f
 
+	if mode == Strict && f.V != 2 {
+		return 0, &ParseError{Offset: 0, Err: ErrBadVersion}
+	}
+
 	secondByte := data[1]
 	f.Marker = (secondByte & 0x80) >> 7
 	f.PT = secondByte & 0x7f
@@ -148,39 +275,73 @@ func (f *Packet) Decode(data []byte) int {
 
 	cc := int(f.CC)
 	if len(data[FixedHeaderSize:]) < cc*4 {
-		return Lack
+		return 0, &ParseError{Offset: len(data), Err: ErrShortPacket}
 	}
 
-	f.CSRC = make([]uint32, cc)
+	if cap(f.CSRC) >= cc {
+		f.CSRC = f.CSRC[:cc]
+	} else {
+		f.CSRC = make([]uint32, cc)
+	}
 	index := FixedHeaderSize
 	for i := 0; i < cc; i++ {
 		f.CSRC[i] = binary.BigEndian.Uint32(data[index:])
 		index += 4
 	}
 
-	extensionSize := 0
 	if f.X == 1 {
-		f.Extension = &Extension{}
-		status := f.Extension.Decode(data[index:])
-		if status < 0 {
-			return status
+		if f.Extension == nil {
+			f.Extension = &Extension{}
+		}
+		n := f.Extension.Decode(data[index:])
+		if n < 0 {
+			return 0, &ParseError{Offset: index, Err: ErrExtensionTruncated}
 		}
-		extensionSize = status
+		index += n
+	} else {
+		f.Extension = nil
 	}
+	return index, nil
+}
 
-	start := index + extensionSize
-	end := len(data)
+// ParseMode selects how strictly Parse validates a packet
+type ParseMode int
 
-	// padding
-	if f.P == 1 {
-		end -= int(data[end-1])
-	}
-	if end < start {
-		return Illegal
-	}
+const (
+	// Lenient accepts any version and a zero padding count
+	Lenient ParseMode = iota
 
-	f.Payload = data[start:end]
-	return len(data)
+	// Strict rejects packets not conforming to RFC 3550
+	Strict
+)
+
+var (
+	ErrShortPacket        = errors.New("rtp: short packet")
+	ErrBadVersion         = errors.New("rtp: bad version")
+	ErrBadPadding         = errors.New("rtp: bad padding")
+	ErrExtensionTruncated = errors.New("rtp: extension truncated")
+)
+
+// ParseError reports why and where a packet failed to parse
+type ParseError struct {
+	Offset int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at offset %d", e.Err, e.Offset)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// errorCode maps a parse error to a decode status code
+func errorCode(err error) int {
+	if errors.Is(err, ErrShortPacket) || errors.Is(err, ErrExtensionTruncated) {
+		return Lack
+	}
+	return Illegal
 }
 
 func (f *Packet) String() string {
@@ -1,5 +1,7 @@
 package rtp
 
+import "sync"
+
 const (
 	AcceptOk = iota
 	DenyPacketNil
@@ -7,6 +9,7 @@ const (
 	DenyFrameFull
 	DenyPacketDuplicated
 	Deny
+	DenyFrameReleased
 )
 
 type Cursor interface {
@@ -24,6 +27,7 @@ type PacketList interface {
 	First() *Packet
 	Last() *Packet
 	Insert(*Packet) int
+	Release()
 }
 
 type Node struct {
@@ -32,6 +36,12 @@ type Node struct {
 	next *Node
 }
 
+var nodePool = sync.Pool{
+	New: func() any {
+		return &Node{}
+	},
+}
+
 type cursor struct {
 	curr *Node
 }
@@ -90,13 +100,34 @@ func getCount(start, end uint16) int {
 }
 
 func (list *packetList) Insert(p *Packet) int {
-	ok := list.insert(p)
+	newNode := nodePool.Get().(*Node)
+	newNode.pkg = p
+
+	ok := list.insert(newNode)
 	if ok == AcceptOk {
 		list.count += 1
+	} else {
+		*newNode = Node{}
+		nodePool.Put(newNode)
 	}
 	return ok
 }
 
+// Release releases every packet and empties the list
+func (list *packetList) Release() {
+	for n := list.head; n != nil; {
+		next := n.next
+		n.pkg.Release()
+		*n = Node{}
+		nodePool.Put(n)
+		n = next
+	}
+
+	list.head = nil
+	list.tail = nil
+	list.count = 0
+}
+
 // Binary search for the insertion point
 func (list *packetList) findInsertPoint(p *Packet) *Node {
 	low, high := list.head, list.tail
@@ -121,8 +152,8 @@ func (list *packetList) findInsertPoint(p *Packet) *Node {
 	return low
 }
 
-func (list *packetList) insert(p *Packet) int {
-	newNode := &Node{pkg: p}
+func (list *packetList) insert(newNode *Node) int {
+	p := newNode.pkg
 	if list.head == nil {
 		list.head = newNode
 		list.tail = newNode
@@ -1,7 +1,10 @@
 package rtp
 
 import (
+	"context"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -75,3 +78,142 @@ func TestBasic(t *testing.T) {
 		assert.True(t, b == bytes[i])
 	}
 }
+
+func TestMarshalTo(t *testing.T) {
+	p := &Packet{
+		Marker:    1,
+		PT:        96,
+		Seq:       27023,
+		Timestamp: 3653407706,
+		SSRC:      476325762,
+		CSRC:      []uint32{1, 2},
+		Extension: &Extension{
+			Profile:          1,
+			Length:           1,
+			HeaderExtensions: []byte{0xFF, 0xFF, 0xFF, 0xFF},
+		},
+		Payload: []byte{0x98, 0x36, 0xbe, 0x88, 0x9e},
+	}
+
+	buf := make([]byte, 1500)
+	_, err := p.MarshalTo(buf[:p.MarshalSize()-1])
+	assert.ErrorIs(t, err, io.ErrShortBuffer)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		p.MarshalTo(buf)
+	})
+	assert.Equal(t, float64(0), allocs)
+
+	n, err := p.MarshalTo(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, p.MarshalSize(), n)
+
+	data, err := p.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, buf[:n], data)
+
+	decoded := &Packet{CSRC: make([]uint32, 0, 15)}
+	csrc := decoded.CSRC
+	size, err := decoded.UnmarshalHeader(data)
+	assert.Nil(t, err)
+	assert.Equal(t, n-len(p.Payload), size)
+	assert.Equal(t, p.CSRC, decoded.CSRC)
+	assert.True(t, &csrc[:1][0] == &decoded.CSRC[0])
+	assert.Nil(t, decoded.Payload)
+
+	decoded = &Packet{}
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	data[len(data)-1] = 0
+	assert.Equal(t, byte(0x9e), decoded.Payload[4])
+
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data[:10]), ErrShortPacket)
+}
+
+func TestParseErrors(t *testing.T) {
+	valid := (&Packet{Seq: 1, SSRC: 1234, Payload: []byte{1, 2, 3}}).Encode()
+
+	p := &Packet{}
+	badVersion := append([]byte{}, valid...)
+	badVersion[0] = 1 << 6
+	assert.ErrorIs(t, p.Parse(badVersion, Strict), ErrBadVersion)
+	assert.Nil(t, p.Parse(badVersion, Lenient))
+
+	zeroPadding := append([]byte{}, valid...)
+	zeroPadding[0] |= 0x20
+	zeroPadding[len(zeroPadding)-1] = 0
+	assert.ErrorIs(t, p.Parse(zeroPadding, Strict), ErrBadPadding)
+	assert.Nil(t, p.Parse(zeroPadding, Lenient))
+	assert.Equal(t, []byte{1, 2, 0}, p.Payload)
+
+	overPadding := append([]byte{}, valid...)
+	overPadding[0] |= 0x20
+	overPadding[len(overPadding)-1] = 4
+	err := p.Parse(overPadding, Lenient)
+	var pe *ParseError
+	assert.ErrorAs(t, err, &pe)
+	assert.ErrorIs(t, err, ErrBadPadding)
+	assert.Equal(t, len(overPadding)-1, pe.Offset)
+	assert.Equal(t, Illegal, p.Decode(overPadding))
+
+	truncated := (&Packet{CSRC: []uint32{7}, Extension: &Extension{Length: 2, HeaderExtensions: make([]byte, 8)}}).Encode()
+	err = p.Parse(truncated[:20], Strict)
+	assert.ErrorIs(t, err, ErrExtensionTruncated)
+	assert.ErrorAs(t, err, &pe)
+	assert.Equal(t, 16, pe.Offset)
+	assert.Equal(t, Lack, p.Decode(truncated[:20]))
+
+	assert.ErrorIs(t, p.Parse(valid[:5], Strict), ErrShortPacket)
+}
+
+func TestPadding(t *testing.T) {
+	p := &Packet{Seq: 1, SSRC: 1234, Payload: []byte{1, 2, 3}, PaddingSize: 5}
+	data := p.Encode()
+	assert.Equal(t, FixedHeaderSize+3+5, len(data))
+	assert.Equal(t, []byte{0, 0, 0, 0, 5}, data[len(data)-5:])
+
+	decoded := &Packet{}
+	assert.Nil(t, decoded.Parse(data, Strict))
+	assert.Equal(t, byte(1), decoded.P)
+	assert.Equal(t, byte(5), decoded.PaddingSize)
+	assert.Equal(t, []byte{1, 2, 3}, decoded.Payload)
+}
+
+func TestPaddingProbe(t *testing.T) {
+	var sent [][]byte
+	sender := NewStream(1234, time.Second, func(p *Packet) error {
+		sent = append(sent, p.Encode())
+		p.Release()
+		return nil
+	})
+
+	sender.WriteFrame([]byte{1}, 96, 3000, nil)
+	assert.Nil(t, sender.WritePadding(200))
+	sender.WriteFrame([]byte{2}, 96, 3000, nil)
+	assert.NotNil(t, sender.WritePadding(0))
+
+	probe := &Packet{}
+	assert.Nil(t, probe.Parse(sent[1], Strict))
+	first := &Packet{}
+	first.Parse(sent[0], Strict)
+	assert.Equal(t, first.Timestamp, probe.Timestamp)
+	assert.Equal(t, first.Seq+1, probe.Seq)
+	assert.Equal(t, byte(96), probe.PT)
+	assert.Empty(t, probe.Payload)
+
+	receiver := NewStream(1234, 50*time.Millisecond, nil)
+	go func() {
+		for _, data := range sent {
+			p := &Packet{}
+			p.Parse(data, Strict)
+			receiver.dispatch(p)
+		}
+	}()
+
+	f, _ := receiver.ReadFrame(context.Background())
+	assert.Equal(t, []byte{1}, f.First().Payload)
+
+	// the probe fills the sequence gap, the next frame completes at once
+	f, err := receiver.ReadFrame(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{2}, f.First().Payload)
+}
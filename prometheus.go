@@ -0,0 +1,293 @@
+package rtp
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry collects the metrics of Conns and serves them in the Prometheus
+// text exposition format.
+type Registry struct {
+	mutex sync.Mutex
+	conns []*connMetrics
+	next  int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// WithRegistry records the metrics of the Conn in r until it closes, name
+// is the conn label of its series, empty means a sequence number. A name in
+// use by another Conn, such as through ListenConfig.Options, is suffixed by
+// a sequence number.
+func WithRegistry(r *Registry, name string) ConnOption {
+	return func(c *conn) {
+		cm := &connMetrics{
+			conn:    c,
+			sources: map[uint32]*sourceMetrics{},
+		}
+		c.metrics = cm
+		c.onReady = append(c.onReady, func() {
+			r.add(cm, name)
+		})
+		c.onClose = append(c.onClose, func() {
+			r.remove(cm)
+		})
+		c.onRemove = append(c.onRemove, cm.forget)
+	}
+}
+
+// add registers cm once its conn is built, a scrape reads its queues
+func (r *Registry) add(cm *connMetrics, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.next += 1
+	if name == "" {
+		name = strconv.Itoa(r.next)
+	}
+	for _, m := range r.conns {
+		if m.name == name {
+			name += "-" + strconv.Itoa(r.next)
+			break
+		}
+	}
+	cm.name = name
+	r.conns = append(r.conns, cm)
+}
+
+func (r *Registry) remove(cm *connMetrics) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, m := range r.conns {
+		if m == cm {
+			r.conns = append(r.conns[:i], r.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+type sourceMetrics struct {
+	packetsIn, bytesIn   uint64
+	packetsOut, bytesOut uint64
+	denied               map[int]uint64
+	dropped              map[string]uint64
+	framesDropped        map[string]uint64
+	completed, timedOut  uint64
+}
+
+// connMetrics is the Metrics sink of a registered conn
+type connMetrics struct {
+	name string
+	conn *conn
+
+	mutex       sync.Mutex
+	parseErrors uint64
+	sources     map[uint32]*sourceMetrics
+}
+
+// source returns the counters of ssrc, the mutex must be held
+func (cm *connMetrics) source(ssrc uint32) *sourceMetrics {
+	sm := cm.sources[ssrc]
+	if sm == nil {
+		sm = &sourceMetrics{
+			denied:        map[int]uint64{},
+			dropped:       map[string]uint64{},
+			framesDropped: map[string]uint64{},
+		}
+		cm.sources[ssrc] = sm
+	}
+	return sm
+}
+
+// forget drops the series of a removed stream
+func (cm *connMetrics) forget(ssrc uint32) {
+	cm.mutex.Lock()
+	delete(cm.sources, ssrc)
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) PacketReceived(ssrc uint32, size int) {
+	cm.mutex.Lock()
+	sm := cm.source(ssrc)
+	sm.packetsIn += 1
+	sm.bytesIn += uint64(size)
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) PacketSent(ssrc uint32, size int) {
+	cm.mutex.Lock()
+	sm := cm.source(ssrc)
+	sm.packetsOut += 1
+	sm.bytesOut += uint64(size)
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) ParseError() {
+	cm.mutex.Lock()
+	cm.parseErrors += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) DispatchDenied(ssrc uint32, reason int) {
+	cm.mutex.Lock()
+	cm.source(ssrc).denied[reason] += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) FrameCompleted(ssrc uint32) {
+	cm.mutex.Lock()
+	cm.source(ssrc).completed += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) FrameTimedOut(ssrc uint32) {
+	cm.mutex.Lock()
+	cm.source(ssrc).timedOut += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) PacketDropped(ssrc uint32, queue string) {
+	cm.mutex.Lock()
+	cm.source(ssrc).dropped[queue] += 1
+	cm.mutex.Unlock()
+}
+
+func (cm *connMetrics) FrameDropped(ssrc uint32, reason string) {
+	cm.mutex.Lock()
+	cm.source(ssrc).framesDropped[reason] += 1
+	cm.mutex.Unlock()
+}
+
+var denyReasons = map[int]string{
+	DenyPacketNil:        "packet_nil",
+	DenyTimestampInvalid: "timestamp_invalid",
+	DenyFrameFull:        "frame_full",
+	DenyPacketDuplicated: "packet_duplicated",
+	Deny:                 "other",
+	DenyFrameReleased:    "frame_released",
+}
+
+type metricFamily struct {
+	name, help, typ string
+	lines           []string
+}
+
+func (mf *metricFamily) add(labels string, value float64) {
+	mf.lines = append(mf.lines, mf.name+"{"+labels+"} "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// ServeHTTP writes the metrics of every registered Conn
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		packetsIn   = &metricFamily{name: "rtp_packets_received_total", help: "RTP packets received.", typ: "counter"}
+		bytesIn     = &metricFamily{name: "rtp_bytes_received_total", help: "RTP octets received.", typ: "counter"}
+		packetsOut  = &metricFamily{name: "rtp_packets_sent_total", help: "RTP packets sent.", typ: "counter"}
+		bytesOut    = &metricFamily{name: "rtp_bytes_sent_total", help: "RTP octets sent.", typ: "counter"}
+		parseErrors = &metricFamily{name: "rtp_parse_errors_total", help: "Malformed RTP packets dropped.", typ: "counter"}
+		denied      = &metricFamily{name: "rtp_dispatch_denied_total", help: "RTP packets refused by their frame.", typ: "counter"}
+		completed   = &metricFamily{name: "rtp_frames_completed_total", help: "Frames read complete.", typ: "counter"}
+		timedOut    = &metricFamily{name: "rtp_frames_timed_out_total", help: "Frames read incomplete after the timeout.", typ: "counter"}
+		dropped     = &metricFamily{name: "rtp_packets_dropped_total", help: "RTP packets dropped by a full queue.", typ: "counter"}
+		frames      = &metricFamily{name: "rtp_frames_dropped_total", help: "Frames dropped before reading.", typ: "counter"}
+		writeQueue  = &metricFamily{name: "rtp_write_queue_depth", help: "RTP packets waiting to be sent.", typ: "gauge"}
+		dispatch    = &metricFamily{name: "rtp_dispatch_queue_depth", help: "RTP packets waiting for their stream.", typ: "gauge"}
+		jitter      = &metricFamily{name: "rtp_jitter_seconds", help: "Interarrival jitter of a source.", typ: "gauge"}
+		lost        = &metricFamily{name: "rtp_packets_lost", help: "Cumulative packets lost of a source.", typ: "gauge"}
+	)
+
+	r.mutex.Lock()
+	conns := append([]*connMetrics(nil), r.conns...)
+	r.mutex.Unlock()
+
+	for _, cm := range conns {
+		connLabel := `conn="` + escapeLabel(cm.name) + `"`
+		writeQueue.add(connLabel, float64(cm.conn.writeQ.len()))
+		dispatch.add(connLabel, float64(cm.conn.queuedDispatch()))
+
+		streams := cm.conn.snapshot()
+		sort.Slice(streams, func(i, j int) bool {
+			return streams[i].SSRC() < streams[j].SSRC()
+		})
+		for _, s := range streams {
+			recv, _ := s.stats()
+			if j, l, ok := recv.quality(); ok {
+				labels := connLabel + `,ssrc="` + strconv.FormatUint(uint64(s.SSRC()), 10) + `"`
+				jitter.add(labels, j)
+				lost.add(labels, float64(l))
+			}
+		}
+
+		cm.mutex.Lock()
+		parseErrors.add(connLabel, float64(cm.parseErrors))
+
+		ssrcs := make([]uint32, 0, len(cm.sources))
+		for ssrc := range cm.sources {
+			ssrcs = append(ssrcs, ssrc)
+		}
+		sort.Slice(ssrcs, func(i, j int) bool { return ssrcs[i] < ssrcs[j] })
+
+		for _, ssrc := range ssrcs {
+			sm := cm.sources[ssrc]
+			labels := connLabel + `,ssrc="` + strconv.FormatUint(uint64(ssrc), 10) + `"`
+			packetsIn.add(labels, float64(sm.packetsIn))
+			bytesIn.add(labels, float64(sm.bytesIn))
+			packetsOut.add(labels, float64(sm.packetsOut))
+			bytesOut.add(labels, float64(sm.bytesOut))
+			completed.add(labels, float64(sm.completed))
+			timedOut.add(labels, float64(sm.timedOut))
+
+			reasons := make([]int, 0, len(sm.denied))
+			for reason := range sm.denied {
+				reasons = append(reasons, reason)
+			}
+			sort.Ints(reasons)
+			for _, reason := range reasons {
+				name, ok := denyReasons[reason]
+				if !ok {
+					name = strconv.Itoa(reason)
+				}
+				denied.add(labels+`,reason="`+name+`"`, float64(sm.denied[reason]))
+			}
+			for _, queue := range []string{"dispatch", "read", "write"} {
+				if n, ok := sm.dropped[queue]; ok {
+					dropped.add(labels+`,queue="`+queue+`"`, float64(n))
+				}
+			}
+
+			causes := make([]string, 0, len(sm.framesDropped))
+			for reason := range sm.framesDropped {
+				causes = append(causes, reason)
+			}
+			sort.Strings(causes)
+			for _, reason := range causes {
+				frames.add(labels+`,reason="`+escapeLabel(reason)+`"`, float64(sm.framesDropped[reason]))
+			}
+		}
+		cm.mutex.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, mf := range []*metricFamily{packetsIn, bytesIn, packetsOut, bytesOut, parseErrors, denied,
+		completed, timedOut, dropped, frames, writeQueue, dispatch, jitter, lost} {
+		bw.WriteString("# HELP " + mf.name + " " + mf.help + "\n")
+		bw.WriteString("# TYPE " + mf.name + " " + mf.typ + "\n")
+		for _, line := range mf.lines {
+			bw.WriteString(line + "\n")
+		}
+	}
+	bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,57 @@
+package rtp
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	dc := newDatagramConn()
+	c := NewConn(dc, time.Second, WithRegistry(r, `peer "a"`))
+
+	dc.readCh <- []byte{0x80, 0x60}
+	for _, seq := range []uint16{1, 3, 3} {
+		p := &Packet{Seq: seq, Timestamp: 3000, SSRC: 1234, Payload: []byte{1, 2}}
+		dc.readCh <- p.Encode()
+	}
+	c.Stream(42).WriteFrame([]byte{1, 2, 3}, 96, 3000, nil)
+	time.Sleep(50 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	assert.Contains(t, w.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Contains(t, body, "# TYPE rtp_packets_received_total counter\n")
+	assert.Contains(t, body, `rtp_packets_received_total{conn="peer \"a\"",ssrc="1234"} 3`)
+	assert.Contains(t, body, `rtp_bytes_received_total{conn="peer \"a\"",ssrc="1234"} 42`)
+	assert.Contains(t, body, `rtp_packets_sent_total{conn="peer \"a\"",ssrc="42"} 1`)
+	assert.Contains(t, body, `rtp_bytes_sent_total{conn="peer \"a\"",ssrc="42"} 15`)
+	assert.Contains(t, body, `rtp_parse_errors_total{conn="peer \"a\""} 1`)
+	assert.Contains(t, body, `rtp_dispatch_denied_total{conn="peer \"a\"",ssrc="1234",reason="packet_duplicated"} 1`)
+	assert.Contains(t, body, `rtp_packets_lost{conn="peer \"a\"",ssrc="1234"} 0`)
+	assert.Contains(t, body, `rtp_write_queue_depth{conn="peer \"a\""} 0`)
+
+	// the sessions of a Listener share the options
+	other := NewConn(newDatagramConn(), time.Second, WithRegistry(r, `peer "a"`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `rtp_write_queue_depth{conn="peer \"a\"-2"} 0`)
+	other.Close()
+
+	// the series of a removed stream go with it
+	assert.True(t, c.RemoveStream(1234))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.NotContains(t, w.Body.String(), `ssrc="1234"`)
+	assert.Contains(t, w.Body.String(), `ssrc="42"`)
+
+	c.Close()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.NotContains(t, w.Body.String(), "peer")
+}
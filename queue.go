@@ -0,0 +1,288 @@
+package rtp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultQueueDepth = 100
+
+// QueuePolicy selects what happens to a packet queued on a full queue
+type QueuePolicy int
+
+const (
+	// QueueBlock waits for room
+	QueueBlock QueuePolicy = iota
+
+	// QueueDropNewest drops the packet being queued
+	QueueDropNewest
+
+	// QueueDropOldest drops the packet at the head of the queue
+	QueueDropOldest
+
+	// QueueDropFrame drops the whole frame of the packet being queued, a
+	// key frame instead evicts the oldest queued frame, preferably not a key
+	// frame. Key frames are told by WithKeyFrame.
+	QueueDropFrame
+)
+
+type queueItem struct {
+	s   Stream
+	p   *Packet
+	key bool
+}
+
+// sameFrame reports whether the items belong to the same frame
+func (qi *queueItem) sameFrame(o *queueItem) bool {
+	return qi.p.SSRC == o.p.SSRC && qi.p.Timestamp == o.p.Timestamp
+}
+
+// packetQueue is a bounded FIFO of packets applying a QueuePolicy when full
+type packetQueue struct {
+	mutex  sync.Mutex
+	items  []queueItem
+	head   int
+	count  int
+	policy QueuePolicy
+
+	// dropped is the timestamp of the frame being dropped per SSRC
+	dropped map[uint32]uint32
+
+	// drop is called with every dropped item
+	drop func(item queueItem)
+
+	notEmpty chan struct{}
+	notFull  chan struct{}
+
+	// woken makes a waiting poll return without an item
+	woken chan struct{}
+
+	// closed makes blocked pushes fail with ErrClosed
+	closed <-chan struct{}
+}
+
+func newPacketQueue(depth int, policy QueuePolicy, closed <-chan struct{}, drop func(item queueItem)) *packetQueue {
+	if depth < 1 {
+		depth = 1
+	}
+	return &packetQueue{
+		items:    make([]queueItem, depth),
+		policy:   policy,
+		dropped:  map[uint32]uint32{},
+		drop:     drop,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		woken:    make(chan struct{}, 1),
+		closed:   closed,
+	}
+}
+
+func (q *packetQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.count
+}
+
+// push queues item, with QueueBlock it waits for room until ctx is done or
+// the queue is closed
+func (q *packetQueue) push(ctx context.Context, item queueItem) error {
+	for {
+		select {
+		case <-q.closed:
+			return ErrClosed
+		default:
+		}
+
+		q.mutex.Lock()
+		if q.policy == QueueDropFrame && q.dropping(&item) {
+			q.mutex.Unlock()
+			q.drop(item)
+			return nil
+		}
+
+		if q.count == len(q.items) {
+			switch q.policy {
+			case QueueBlock:
+				q.mutex.Unlock()
+				select {
+				case <-q.notFull:
+					continue
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-q.closed:
+					return ErrClosed
+				}
+
+			case QueueDropNewest:
+				q.mutex.Unlock()
+				q.drop(item)
+				return nil
+
+			case QueueDropOldest:
+				q.drop(q.take())
+
+			case QueueDropFrame:
+				victim, ok := q.victim(&item)
+				if !ok {
+					q.dropped[item.p.SSRC] = item.p.Timestamp
+					q.evict(&item)
+					q.mutex.Unlock()
+					q.drop(item)
+					return nil
+				}
+				q.dropped[victim.p.SSRC] = victim.p.Timestamp
+				q.evict(&victim)
+			}
+		}
+
+		q.items[(q.head+q.count)%len(q.items)] = item
+		q.count += 1
+		room := q.count < len(q.items)
+		q.mutex.Unlock()
+
+		signal(q.notEmpty)
+		if room {
+			signal(q.notFull)
+		}
+		return nil
+	}
+}
+
+// dropping reports whether item belongs to a frame being dropped, the mutex
+// must be held
+func (q *packetQueue) dropping(item *queueItem) bool {
+	ts, ok := q.dropped[item.p.SSRC]
+	if !ok {
+		return false
+	}
+	if ts == item.p.Timestamp {
+		return true
+	}
+	delete(q.dropped, item.p.SSRC)
+	return false
+}
+
+// victim returns a queued packet whose frame is dropped to make room for a
+// key frame packet: the oldest non key frame or else the oldest frame. ok
+// is false when the frame of item itself has to be dropped. The mutex must
+// be held.
+func (q *packetQueue) victim(item *queueItem) (queueItem, bool) {
+	if !item.key {
+		return queueItem{}, false
+	}
+
+	for i := 0; i < q.count; i++ {
+		if it := q.items[(q.head+i)%len(q.items)]; !it.key && !it.sameFrame(item) {
+			return it, true
+		}
+	}
+
+	if head := q.items[q.head]; !head.sameFrame(item) {
+		return head, true
+	}
+	return queueItem{}, false
+}
+
+// evict drops the queued packets of the frame of item, the mutex must be
+// held
+func (q *packetQueue) evict(item *queueItem) {
+	kept := 0
+	for i := 0; i < q.count; i++ {
+		it := q.items[(q.head+i)%len(q.items)]
+		if it.sameFrame(item) {
+			q.drop(it)
+			continue
+		}
+		q.items[(q.head+kept)%len(q.items)] = it
+		kept += 1
+	}
+	for i := kept; i < q.count; i++ {
+		q.items[(q.head+i)%len(q.items)] = queueItem{}
+	}
+	q.count = kept
+}
+
+// take removes the head item, the mutex must be held and the queue not
+// empty
+func (q *packetQueue) take() queueItem {
+	item := q.items[q.head]
+	q.items[q.head] = queueItem{}
+	q.head = (q.head + 1) % len(q.items)
+	q.count -= 1
+	return item
+}
+
+// pop waits for an item until ctx is done
+func (q *packetQueue) pop(ctx context.Context) (queueItem, bool) {
+	return q.poll(ctx, 0)
+}
+
+// poll waits for an item until ctx is done, wake is called or, if positive,
+// for wait
+func (q *packetQueue) poll(ctx context.Context, wait time.Duration) (queueItem, bool) {
+	var expired <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		if item, ok := q.tryPop(); ok {
+			return item, true
+		}
+
+		select {
+		case <-q.notEmpty:
+		case <-ctx.Done():
+			return queueItem{}, false
+		case <-expired:
+			return queueItem{}, false
+		case <-q.woken:
+			return queueItem{}, false
+		}
+	}
+}
+
+// wake makes the waiting or next poll return without an item
+func (q *packetQueue) wake() {
+	signal(q.woken)
+}
+
+func (q *packetQueue) tryPop() (queueItem, bool) {
+	q.mutex.Lock()
+	if q.count == 0 {
+		q.mutex.Unlock()
+		return queueItem{}, false
+	}
+
+	item := q.take()
+	more := q.count > 0
+	q.mutex.Unlock()
+
+	signal(q.notFull)
+	if more {
+		signal(q.notEmpty)
+	}
+	return item, true
+}
+
+// release releases the queued packets
+func (q *packetQueue) release() {
+	for {
+		item, ok := q.tryPop()
+		if !ok {
+			return
+		}
+		item.p.Release()
+	}
+}
+
+// signal wakes up a waiter of ch without blocking
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,82 @@
+package rtp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func queuedTimestamps(q *packetQueue) []uint32 {
+	var ts []uint32
+	for {
+		item, ok := q.tryPop()
+		if !ok {
+			return ts
+		}
+		ts = append(ts, item.p.Timestamp)
+	}
+}
+
+func TestQueuePolicies(t *testing.T) {
+	push := func(q *packetQueue, ts uint32, key bool) {
+		q.push(context.Background(), queueItem{p: &Packet{SSRC: 1, Timestamp: ts}, key: key})
+	}
+
+	var dropped []uint32
+	drop := func(item queueItem) {
+		dropped = append(dropped, item.p.Timestamp)
+	}
+
+	q := newPacketQueue(2, QueueDropNewest, nil, drop)
+	push(q, 1, false)
+	push(q, 2, false)
+	push(q, 3, false)
+	assert.Equal(t, []uint32{1, 2}, queuedTimestamps(q))
+	assert.Equal(t, []uint32{3}, dropped)
+
+	dropped = nil
+	q = newPacketQueue(2, QueueDropOldest, nil, drop)
+	push(q, 1, false)
+	push(q, 2, false)
+	push(q, 3, false)
+	assert.Equal(t, []uint32{2, 3}, queuedTimestamps(q))
+	assert.Equal(t, []uint32{1}, dropped)
+
+	// a delta frame not fitting is dropped whole, a key frame evicts the
+	// oldest delta frame
+	dropped = nil
+	q = newPacketQueue(4, QueueDropFrame, nil, drop)
+	push(q, 1, true)
+	push(q, 2, false)
+	push(q, 2, false)
+	push(q, 3, false)
+	push(q, 3, false)
+	push(q, 3, false)
+	push(q, 4, true)
+	push(q, 4, true)
+	push(q, 2, false)
+	assert.Equal(t, []uint32{3, 3, 3, 2, 2, 2}, dropped)
+	assert.Equal(t, []uint32{1, 4, 4}, queuedTimestamps(q))
+
+	// a blocked push gives up with its context
+	q = newPacketQueue(1, QueueBlock, nil, drop)
+	push(q, 1, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.push(ctx, queueItem{p: &Packet{}}), context.DeadlineExceeded)
+}
+
+func TestWriteFrameContext(t *testing.T) {
+	bc := &blockingConn{datagramConn: newDatagramConn(), written: make(chan []byte)}
+	c := NewConn(bc, time.Second, WithWriteQueue(1))
+	defer c.Close()
+	s := c.Stream(1234)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	n, err := s.WriteFrameContext(ctx, make([]byte, 3*MTU), 96, 3000, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 2*MTU, n)
+}
@@ -0,0 +1,323 @@
+package rtp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"time"
+)
+
+const (
+	rtcpMinInterval      = 5 * time.Second
+	rtcpSenderFraction   = 0.25
+	rtcpReceiverFraction = 1 - rtcpSenderFraction
+
+	// e - 3/2, compensates the timer reconsideration of RFC 3550 A.7
+	rtcpCompensation = 2.71828 - 1.5
+
+	udpIPOverhead = 28
+
+	// defaultSessionBandwidth is the session bandwidth in bits per second
+	defaultSessionBandwidth = 1000000
+)
+
+// rtcpInterval computes the RTCP report interval of RFC 3550 A.7, the
+// interval grows with the number of members so that the RTCP traffic of the
+// whole session stays within rtcpBW octets per second.
+func rtcpInterval(members, senders int, rtcpBW, avgSize float64, weSent, initial bool) time.Duration {
+	minTime := rtcpMinInterval.Seconds()
+	if initial {
+		minTime /= 2
+	}
+
+	n := members
+	if float64(senders) <= float64(members)*rtcpSenderFraction {
+		if weSent {
+			rtcpBW *= rtcpSenderFraction
+			n = senders
+		} else {
+			rtcpBW *= rtcpReceiverFraction
+			n -= senders
+		}
+	}
+
+	t := avgSize * float64(n) / rtcpBW
+	if t < minTime {
+		t = minTime
+	}
+
+	t = t * (rand.Float64() + 0.5) / rtcpCompensation
+	return time.Duration(t * float64(time.Second))
+}
+
+// enableRTCP turns on RTCP reports, rw is the RTCP transport or nil to
+// multiplex RTCP with RTP. bandwidth is the session bandwidth in bits per
+// second of which 5% is used for RTCP.
+func (c *conn) enableRTCP(rw io.ReadWriteCloser, bandwidth int) {
+	if bandwidth <= 0 {
+		bandwidth = defaultSessionBandwidth
+	}
+
+	c.rtcpConn = rw
+	c.reporting = true
+	c.bandwidth = float64(bandwidth) / 8 * 0.05
+}
+
+func (c *conn) rtcpPump() {
+	var buff = make([]byte, maxDatagramSize)
+	for {
+		n, err := c.rtcpConn.Read(buff)
+		if errors.Is(err, io.ErrShortBuffer) {
+			continue
+		}
+		if err != nil {
+			if !c.isClosed() {
+				c.log.Error("rtcp read failed", "err", err)
+			}
+			return
+		}
+		c.handleRTCP(buff[:n])
+	}
+}
+
+func (c *conn) handleRTCP(data []byte) {
+	pkts, code := DecodeRTCP(data)
+	if code < 0 {
+		c.log.Warn("rtcp parse failed", "code", code)
+		return
+	}
+	c.updateAvgRTCPSize(len(data))
+
+	if err := c.inboundRTCP(pkts); err != nil {
+		c.log.Warn("rtcp inbound failed", "err", err)
+	}
+}
+
+// processRTCP ends the inbound RTCP chain
+func (c *conn) processRTCP(pkts []RTCPPacket) error {
+	now := time.Now()
+	for _, p := range pkts {
+		switch p := p.(type) {
+		case *SenderReport:
+			c.touchMember(p.SSRC, now)
+			if s := c.lookup(p.SSRC); s != nil {
+				recv, _ := s.stats()
+				recv.onSenderReport(p.NTPTime, p.RTPTime, now)
+			}
+
+		case *ReceiverReport:
+			c.touchMember(p.SSRC, now)
+
+		case *SourceDescription:
+			for _, chunk := range p.Chunks {
+				c.touchMember(chunk.Source, now)
+				if cname := p.CNAME(chunk.Source); cname != "" {
+					if s := c.lookup(chunk.Source); s != nil {
+						s.setCNAME(cname)
+					}
+				}
+			}
+
+		case *Goodbye:
+			for _, ssrc := range p.Sources {
+				c.goodbye(ssrc)
+			}
+		}
+	}
+	return nil
+}
+
+// goodbye removes the remote source ssrc after its BYE, a BYE naming a
+// local sender is ignored as no peer may remove it
+func (c *conn) goodbye(ssrc uint32) {
+	if s := c.lookup(ssrc); s != nil {
+		if _, send := s.stats(); send.sent() {
+			c.log.Debug("bye of local sender ignored", "ssrc", ssrc)
+			return
+		}
+	}
+
+	c.rtcpMutex.Lock()
+	delete(c.members, ssrc)
+	c.rtcpMutex.Unlock()
+	c.removeStream(ssrc, "bye")
+}
+
+// touchMember records a session member only known from its RTCP packets,
+// such as the receivers of a multicast group.
+func (c *conn) touchMember(ssrc uint32, now time.Time) {
+	c.rtcpMutex.Lock()
+	if c.members == nil {
+		c.members = map[uint32]time.Time{}
+	}
+	c.members[ssrc] = now
+	c.rtcpMutex.Unlock()
+}
+
+func (c *conn) lookup(ssrc uint32) Stream {
+	c.Lock()
+	defer c.Unlock()
+	return c.streams[ssrc]
+}
+
+func (c *conn) updateAvgRTCPSize(size int) {
+	c.rtcpMutex.Lock()
+	defer c.rtcpMutex.Unlock()
+
+	size += udpIPOverhead
+	if c.avgRTCPSize == 0 {
+		c.avgRTCPSize = float64(size)
+		return
+	}
+	c.avgRTCPSize += (float64(size) - c.avgRTCPSize) / 16
+}
+
+func (c *conn) reportInterval(initial bool) time.Duration {
+	var (
+		remote  = map[uint32]bool{}
+		senders int
+		weSent  bool
+	)
+	for _, s := range c.snapshot() {
+		recv, send := s.stats()
+		if send.active() {
+			weSent = true
+			senders += 1
+		}
+		if recv.active() {
+			senders += 1
+		}
+		if recv.member() {
+			remote[s.SSRC()] = true
+		}
+	}
+
+	c.rtcpMutex.Lock()
+	defer c.rtcpMutex.Unlock()
+
+	// members time out after 5 report intervals (RFC 3550 6.3.5)
+	now := time.Now()
+	for ssrc, active := range c.members {
+		if c.interval > 0 && now.Sub(active) > 5*c.interval {
+			delete(c.members, ssrc)
+			continue
+		}
+		remote[ssrc] = true
+	}
+	delete(remote, c.ssrc)
+
+	avgSize := c.avgRTCPSize
+	if avgSize == 0 {
+		// an empty receiver report with a CNAME
+		avgSize = 64 + udpIPOverhead
+	}
+
+	c.interval = rtcpInterval(len(remote)+1, senders, c.bandwidth, avgSize, weSent, initial)
+	return c.interval
+}
+
+func (c *conn) snapshot() []Stream {
+	c.Lock()
+	defer c.Unlock()
+
+	streams := make([]Stream, 0, len(c.streams))
+	for _, s := range c.streams {
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+func (c *conn) reportPump(ctx context.Context) {
+	for initial := true; ; initial = false {
+		timer := time.NewTimer(c.reportInterval(initial))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := c.sendReport(time.Now()); err != nil {
+			c.log.Warn("rtcp report failed", "err", err)
+		}
+	}
+}
+
+// sendReport sends a compound SR or RR with the reception reports of every
+// remote source, followed by the CNAME of the local sources.
+func (c *conn) sendReport(now time.Time) error {
+	var (
+		senders []*SenderReport
+		reports []ReceptionReport
+	)
+
+	for _, s := range c.snapshot() {
+		recv, send := s.stats()
+		if send.active() {
+			senders = append(senders, send.report(s.SSRC(), now))
+		}
+		if r, ok := recv.report(s.SSRC(), now); ok {
+			reports = append(reports, r)
+		}
+	}
+
+	reporter := c.ssrc
+	if len(senders) > 0 {
+		reporter = senders[0].SSRC
+	}
+
+	var pkts []RTCPPacket
+	for i := 0; i == 0 || len(reports) > 0; i++ {
+		count := len(reports)
+		if count > maxReportCount {
+			count = maxReportCount
+		}
+
+		if i == 0 && len(senders) > 0 {
+			senders[0].Reports = reports[:count]
+			pkts = append(pkts, senders[0])
+		} else {
+			pkts = append(pkts, &ReceiverReport{SSRC: reporter, Reports: reports[:count]})
+		}
+		reports = reports[count:]
+	}
+
+	sdes := &SourceDescription{}
+	sdes.Chunks = append(sdes.Chunks, SDESChunk{
+		Source: reporter,
+		Items:  []SDESItem{{Type: SDESCNAME, Text: c.cname}},
+	})
+	for _, sr := range senders {
+		if sr.SSRC != reporter {
+			pkts = append(pkts, sr)
+			sdes.Chunks = append(sdes.Chunks, SDESChunk{
+				Source: sr.SSRC,
+				Items:  []SDESItem{{Type: SDESCNAME, Text: c.cname}},
+			})
+		}
+	}
+	pkts = append(pkts, sdes)
+
+	return c.writeRTCP(pkts...)
+}
+
+func (c *conn) writeRTCP(pkts ...RTCPPacket) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	return c.outboundRTCP(pkts)
+}
+
+// sendRTCP ends the outbound RTCP chain
+func (c *conn) sendRTCP(pkts []RTCPPacket) error {
+	data := EncodeRTCP(pkts...)
+	c.updateAvgRTCPSize(len(data))
+
+	w := c.ReadWriteCloser
+	if c.rtcpConn != nil {
+		w = c.rtcpConn
+	}
+	_, err := w.Write(data)
+	return err
+}
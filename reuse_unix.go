@@ -0,0 +1,17 @@
+//go:build unix
+
+package rtp
+
+import "syscall"
+
+// reuseAddr lets several sessions of the host bind the same group port
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	var err error
+	cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
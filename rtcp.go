@@ -0,0 +1,484 @@
+package rtp
+
+import (
+	"encoding/binary"
+)
+
+const (
+	TypeSenderReport      = 200
+	TypeReceiverReport    = 201
+	TypeSourceDescription = 202
+	TypeGoodbye           = 203
+)
+
+const (
+	SDESEnd   = 0
+	SDESCNAME = 1
+)
+
+const (
+	rtcpHeaderSize      = 4
+	receptionReportSize = 24
+	maxReportCount      = 31
+)
+
+type RTCPPacket interface {
+	Encode() []byte
+	Decode(data []byte) int
+}
+
+/*
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |V=2|P|    RC   |      PT       |             length            |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+func appendRTCPHeader(data []byte, count int, typ byte, size int) []byte {
+	data = append(data, 2<<6|byte(count&0x1f), typ)
+	return binary.BigEndian.AppendUint16(data, uint16(size/4-1))
+}
+
+// rtcpPadding returns the number of bytes to align size to 32 bits
+func rtcpPadding(size int) int {
+	return (4 - size%4) % 4
+}
+
+// DecodeRTCP parses a compound RTCP packet, unknown packet types are skipped
+func DecodeRTCP(data []byte) ([]RTCPPacket, int) {
+	var pkts []RTCPPacket
+	for offset := 0; offset < len(data); {
+		if len(data[offset:]) < rtcpHeaderSize {
+			return pkts, Lack
+		}
+
+		if data[offset]>>6 != 2 {
+			return pkts, Illegal
+		}
+
+		size := (int(binary.BigEndian.Uint16(data[offset+2:])) + 1) * 4
+		if len(data[offset:]) < size {
+			return pkts, Lack
+		}
+
+		body := data[offset : offset+size]
+		if body[0]&0x20 != 0 {
+			padding := int(body[size-1])
+			if padding == 0 || padding > size-rtcpHeaderSize {
+				return pkts, Illegal
+			}
+			body = body[:size-padding]
+		}
+
+		var p RTCPPacket
+		switch body[1] {
+		case TypeSenderReport:
+			p = &SenderReport{}
+		case TypeReceiverReport:
+			p = &ReceiverReport{}
+		case TypeSourceDescription:
+			p = &SourceDescription{}
+		case TypeGoodbye:
+			p = &Goodbye{}
+		}
+
+		if p != nil {
+			if code := p.Decode(body); code < 0 {
+				return pkts, code
+			}
+			pkts = append(pkts, p)
+		}
+		offset += size
+	}
+	return pkts, len(data)
+}
+
+// EncodeRTCP builds a compound RTCP packet
+func EncodeRTCP(pkts ...RTCPPacket) []byte {
+	var data []byte
+	for _, p := range pkts {
+		data = append(data, p.Encode()...)
+	}
+	return data
+}
+
+/*
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+   |                 SSRC_1 (SSRC of first source)                 |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   | fraction lost |       cumulative number of packets lost       |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |           extended highest sequence number received           |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                      interarrival jitter                      |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                         last SR (LSR)                         |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                   delay since last SR (DLSR)                  |
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+*/
+
+type ReceptionReport struct {
+	SSRC             uint32
+	FractionLost     byte
+	TotalLost        uint32
+	HighestSeq       uint32
+	Jitter           uint32
+	LastSR           uint32
+	DelaySinceLastSR uint32
+}
+
+func (r *ReceptionReport) encode(data []byte) []byte {
+	data = binary.BigEndian.AppendUint32(data, r.SSRC)
+	data = binary.BigEndian.AppendUint32(data, uint32(r.FractionLost)<<24|r.TotalLost&0xffffff)
+	data = binary.BigEndian.AppendUint32(data, r.HighestSeq)
+	data = binary.BigEndian.AppendUint32(data, r.Jitter)
+	data = binary.BigEndian.AppendUint32(data, r.LastSR)
+	return binary.BigEndian.AppendUint32(data, r.DelaySinceLastSR)
+}
+
+func (r *ReceptionReport) decode(data []byte) {
+	r.SSRC = binary.BigEndian.Uint32(data)
+	r.FractionLost = data[4]
+	r.TotalLost = binary.BigEndian.Uint32(data[4:]) & 0xffffff
+	r.HighestSeq = binary.BigEndian.Uint32(data[8:])
+	r.Jitter = binary.BigEndian.Uint32(data[12:])
+	r.LastSR = binary.BigEndian.Uint32(data[16:])
+	r.DelaySinceLastSR = binary.BigEndian.Uint32(data[20:])
+}
+
+func decodeReports(data []byte, count int) ([]ReceptionReport, int) {
+	if len(data) < count*receptionReportSize {
+		return nil, Lack
+	}
+
+	if count == 0 {
+		return nil, 0
+	}
+
+	reports := make([]ReceptionReport, count)
+	for i := range reports {
+		reports[i].decode(data[i*receptionReportSize:])
+	}
+	return reports, count * receptionReportSize
+}
+
+/*
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |V=2|P|    RC   |   PT=SR=200   |             length            |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                         SSRC of sender                        |
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+   |              NTP timestamp, most significant word             |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |             NTP timestamp, least significant word             |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                         RTP timestamp                         |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                     sender's packet count                     |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                      sender's octet count                     |
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+   |                       report blocks ...                       |
+*/
+
+type SenderReport struct {
+	SSRC        uint32
+	NTPTime     uint64
+	RTPTime     uint32
+	PacketCount uint32
+	OctetCount  uint32
+	Reports     []ReceptionReport
+}
+
+func (sr *SenderReport) Encode() []byte {
+	size := rtcpHeaderSize + 24 + receptionReportSize*len(sr.Reports)
+	data := make([]byte, 0, size)
+
+	data = appendRTCPHeader(data, len(sr.Reports), TypeSenderReport, size)
+	data = binary.BigEndian.AppendUint32(data, sr.SSRC)
+	data = binary.BigEndian.AppendUint64(data, sr.NTPTime)
+	data = binary.BigEndian.AppendUint32(data, sr.RTPTime)
+	data = binary.BigEndian.AppendUint32(data, sr.PacketCount)
+	data = binary.BigEndian.AppendUint32(data, sr.OctetCount)
+	for i := range sr.Reports {
+		data = sr.Reports[i].encode(data)
+	}
+	return data
+}
+
+func (sr *SenderReport) Decode(data []byte) int {
+	if len(data) < rtcpHeaderSize+24 {
+		return Lack
+	}
+
+	sr.SSRC = binary.BigEndian.Uint32(data[4:])
+	sr.NTPTime = binary.BigEndian.Uint64(data[8:])
+	sr.RTPTime = binary.BigEndian.Uint32(data[16:])
+	sr.PacketCount = binary.BigEndian.Uint32(data[20:])
+	sr.OctetCount = binary.BigEndian.Uint32(data[24:])
+
+	reports, code := decodeReports(data[28:], int(data[0]&0x1f))
+	if code < 0 {
+		return code
+	}
+	sr.Reports = reports
+	return len(data)
+}
+
+/*
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |V=2|P|    RC   |   PT=RR=201   |             length            |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                     SSRC of packet sender                     |
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+   |                       report blocks ...                       |
+*/
+
+type ReceiverReport struct {
+	SSRC    uint32
+	Reports []ReceptionReport
+}
+
+func (rr *ReceiverReport) Encode() []byte {
+	size := rtcpHeaderSize + 4 + receptionReportSize*len(rr.Reports)
+	data := make([]byte, 0, size)
+
+	data = appendRTCPHeader(data, len(rr.Reports), TypeReceiverReport, size)
+	data = binary.BigEndian.AppendUint32(data, rr.SSRC)
+	for i := range rr.Reports {
+		data = rr.Reports[i].encode(data)
+	}
+	return data
+}
+
+func (rr *ReceiverReport) Decode(data []byte) int {
+	if len(data) < rtcpHeaderSize+4 {
+		return Lack
+	}
+
+	rr.SSRC = binary.BigEndian.Uint32(data[4:])
+	reports, code := decodeReports(data[8:], int(data[0]&0x1f))
+	if code < 0 {
+		return code
+	}
+	rr.Reports = reports
+	return len(data)
+}
+
+/*
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |V=2|P|    SC   |  PT=SDES=202  |             length            |
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+   |                          SSRC/CSRC_1                          |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                           SDES items                          |
+   |                              ...                              |
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+*/
+
+type SDESItem struct {
+	Type byte
+	Text string
+}
+
+type SDESChunk struct {
+	Source uint32
+	Items  []SDESItem
+}
+
+type SourceDescription struct {
+	Chunks []SDESChunk
+}
+
+// Encode splits more than 31 chunks across several packets of a compound
+// packet
+func (sd *SourceDescription) Encode() []byte {
+	var data []byte
+	chunks := sd.Chunks
+	for i := 0; i == 0 || len(chunks) > 0; i++ {
+		count := len(chunks)
+		if count > maxReportCount {
+			count = maxReportCount
+		}
+		data = encodeChunks(data, chunks[:count])
+		chunks = chunks[count:]
+	}
+	return data
+}
+
+// encodeChunks appends a packet of up to 31 chunks to data
+func encodeChunks(data []byte, chunks []SDESChunk) []byte {
+	header := len(data)
+	data = appendRTCPHeader(data, len(chunks), TypeSourceDescription, rtcpHeaderSize)
+	for _, c := range chunks {
+		start := len(data)
+		data = binary.BigEndian.AppendUint32(data, c.Source)
+		for _, item := range c.Items {
+			text := item.Text
+			if len(text) > 0xff {
+				text = text[:0xff]
+			}
+			data = append(data, item.Type, byte(len(text)))
+			data = append(data, text...)
+		}
+
+		// at least one null octet terminates the item list
+		data = append(data, SDESEnd)
+		data = append(data, make([]byte, rtcpPadding(len(data)-start))...)
+	}
+
+	binary.BigEndian.PutUint16(data[header+2:], uint16((len(data)-header)/4-1))
+	return data
+}
+
+func (sd *SourceDescription) Decode(data []byte) int {
+	if len(data) < rtcpHeaderSize {
+		return Lack
+	}
+
+	count := int(data[0] & 0x1f)
+	sd.Chunks = make([]SDESChunk, 0, count)
+
+	offset := rtcpHeaderSize
+	for i := 0; i < count; i++ {
+		if len(data[offset:]) < 4 {
+			return Lack
+		}
+
+		c := SDESChunk{Source: binary.BigEndian.Uint32(data[offset:])}
+		start := offset
+		offset += 4
+		for {
+			if offset >= len(data) {
+				return Lack
+			}
+
+			typ := data[offset]
+			if typ == SDESEnd {
+				offset += 1
+				break
+			}
+
+			if offset+2 > len(data) {
+				return Lack
+			}
+			size := int(data[offset+1])
+			if offset+2+size > len(data) {
+				return Lack
+			}
+
+			c.Items = append(c.Items, SDESItem{
+				Type: typ,
+				Text: string(data[offset+2 : offset+2+size]),
+			})
+			offset += 2 + size
+		}
+
+		offset += rtcpPadding(offset - start)
+		sd.Chunks = append(sd.Chunks, c)
+	}
+	return len(data)
+}
+
+// CNAME returns the canonical name of source, empty if not described
+func (sd *SourceDescription) CNAME(source uint32) string {
+	for _, c := range sd.Chunks {
+		if c.Source != source {
+			continue
+		}
+		for _, item := range c.Items {
+			if item.Type == SDESCNAME {
+				return item.Text
+			}
+		}
+	}
+	return ""
+}
+
+/*
+    0                   1                   2                   3
+    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |V=2|P|    SC   |   PT=BYE=203  |             length            |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   |                           SSRC/CSRC                           |
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+   :                              ...                              :
+   +=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+=+
+   |     length    |               reason for leaving            ...
+   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+*/
+
+type Goodbye struct {
+	Sources []uint32
+	Reason  string
+}
+
+// Encode splits more than 31 sources across several packets of a compound
+// packet, the reason is sent with the last one
+func (b *Goodbye) Encode() []byte {
+	reason := b.Reason
+	if len(reason) > 0xff {
+		reason = reason[:0xff]
+	}
+
+	var data []byte
+	sources := b.Sources
+	for i := 0; i == 0 || len(sources) > 0; i++ {
+		count := len(sources)
+		if count > maxReportCount {
+			count = maxReportCount
+		}
+
+		header := len(data)
+		data = appendRTCPHeader(data, count, TypeGoodbye, rtcpHeaderSize)
+		for _, s := range sources[:count] {
+			data = binary.BigEndian.AppendUint32(data, s)
+		}
+		sources = sources[count:]
+
+		if reason != "" && len(sources) == 0 {
+			data = append(data, byte(len(reason)))
+			data = append(data, reason...)
+			data = append(data, make([]byte, rtcpPadding(len(data)-header))...)
+		}
+		binary.BigEndian.PutUint16(data[header+2:], uint16((len(data)-header)/4-1))
+	}
+	return data
+}
+
+func (b *Goodbye) Decode(data []byte) int {
+	if len(data) < rtcpHeaderSize {
+		return Lack
+	}
+
+	count := int(data[0] & 0x1f)
+	offset := rtcpHeaderSize + 4*count
+	if len(data) < offset {
+		return Lack
+	}
+
+	b.Sources = make([]uint32, count)
+	for i := range b.Sources {
+		b.Sources[i] = binary.BigEndian.Uint32(data[rtcpHeaderSize+4*i:])
+	}
+
+	if offset < len(data) {
+		size := int(data[offset])
+		if offset+1+size > len(data) {
+			return Lack
+		}
+		b.Reason = string(data[offset+1 : offset+1+size])
+	}
+	return len(data)
+}
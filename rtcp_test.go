@@ -0,0 +1,74 @@
+package rtp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTCPCompound(t *testing.T) {
+	sr := &SenderReport{
+		SSRC:        1234,
+		NTPTime:     0x0102030405060708,
+		RTPTime:     3000,
+		PacketCount: 10,
+		OctetCount:  1000,
+		Reports: []ReceptionReport{
+			{SSRC: 5678, FractionLost: 12, TotalLost: 34, HighestSeq: 65540, Jitter: 7, LastSR: 9, DelaySinceLastSR: 11},
+		},
+	}
+	rr := &ReceiverReport{SSRC: 4321}
+	sdes := &SourceDescription{
+		Chunks: []SDESChunk{
+			{Source: 1234, Items: []SDESItem{{Type: SDESCNAME, Text: "camera"}}},
+			{Source: 4321, Items: []SDESItem{{Type: SDESCNAME, Text: "mic@host"}}},
+		},
+	}
+	bye := &Goodbye{Sources: []uint32{1234}, Reason: "done"}
+
+	data := EncodeRTCP(sr, rr, sdes, bye)
+	assert.True(t, len(data)%4 == 0)
+
+	pkts, code := DecodeRTCP(data)
+	assert.Equal(t, len(data), code)
+	assert.Equal(t, []RTCPPacket{sr, rr, sdes, bye}, pkts)
+	assert.Equal(t, "mic@host", pkts[2].(*SourceDescription).CNAME(4321))
+
+	_, code = DecodeRTCP(data[:len(data)-2])
+	assert.Equal(t, Lack, code)
+}
+
+func TestRTCPSplit(t *testing.T) {
+	// more than 31 sources do not fit the count of a packet
+	sdes := &SourceDescription{}
+	bye := &Goodbye{Reason: "done"}
+	for i := uint32(0); i < 40; i++ {
+		sdes.Chunks = append(sdes.Chunks, SDESChunk{Source: i, Items: []SDESItem{{Type: SDESCNAME, Text: "host"}}})
+		bye.Sources = append(bye.Sources, i)
+	}
+
+	data := EncodeRTCP(sdes, bye)
+	pkts, code := DecodeRTCP(data)
+	assert.Equal(t, len(data), code)
+	assert.Equal(t, []RTCPPacket{
+		&SourceDescription{Chunks: sdes.Chunks[:31]},
+		&SourceDescription{Chunks: sdes.Chunks[31:]},
+		&Goodbye{Sources: bye.Sources[:31]},
+		&Goodbye{Sources: bye.Sources[31:], Reason: "done"},
+	}, pkts)
+}
+
+func TestRTCPInterval(t *testing.T) {
+	bw := float64(defaultSessionBandwidth) / 8 * 0.05
+
+	small := rtcpInterval(2, 1, bw, 100, false, false)
+	assert.True(t, small <= 2*rtcpMinInterval)
+
+	// thousands of multicast receivers share the RTCP bandwidth
+	large := rtcpInterval(5000, 1, bw, 100, false, false)
+	assert.True(t, large > 4*rtcpMinInterval)
+
+	// senders keep a quarter of the bandwidth for themselves
+	sender := rtcpInterval(5000, 1, bw, 100, true, false)
+	assert.True(t, sender <= 2*rtcpMinInterval)
+}
@@ -5,141 +5,688 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Conn interface {
 	Stream(uint32) Stream
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
 	Close() error
+
+	// CloseWithContext closes the Conn, with CloseDrain queued packets are
+	// sent until ctx is done. Close bounds the drain by the timeout of the
+	// Conn.
+	CloseWithContext(ctx context.Context) error
+
+	// Done is closed when the Conn closes
+	Done() <-chan struct{}
+
+	// Err returns the cause of the close, ErrClosed when closed by the
+	// user, nil while open
+	Err() error
+
+	// OnStream sets a handler called with the stream of every newly
+	// received SSRC before its first packet is dispatched
+	OnStream(handler func(s Stream))
+
+	// Streams returns the streams of the Conn
+	Streams() []Stream
+
+	// RemoveStream closes the stream of ssrc and forgets it, false if there
+	// is none
+	RemoveStream(ssrc uint32) bool
+
+	// OnStreamRemoved sets a handler called with every stream removed and
+	// the reason: "removed", "bye" or "inactive"
+	OnStreamRemoved(handler func(s Stream, reason string))
+
+	// OnConflict sets a handler called with every SSRC collision or loop
+	// detected from the source address of the packets, see Conflict
+	OnConflict(handler func(cf Conflict))
 }
 
-func NewConn(io io.ReadWriteCloser, timeout time.Duration) Conn {
+var ErrClosed = errors.New("rtp: conn closed")
+
+// ClosePolicy selects what happens to the queued packets on close
+type ClosePolicy int
+
+const (
+	// CloseDiscard drops the queued packets
+	CloseDiscard ClosePolicy = iota
+
+	// CloseDrain sends the queued packets before closing
+	CloseDrain
+)
+
+func NewConn(io io.ReadWriteCloser, timeout time.Duration, opts ...ConnOption) Conn {
+	c := newConn(io, timeout, opts...)
+	c.start()
+	return c
+}
+
+func newConn(io io.ReadWriteCloser, timeout time.Duration, opts ...ConnOption) *conn {
 	c := &conn{
 		ReadWriteCloser: io,
 		timeout:         timeout,
 		streams:         map[uint32]Stream{},
-		writeCh:         make(chan *Packet, 100),
-		dispatchCh:      make(chan dispatchItem, 100),
+		workers:         map[uint32]*worker{},
+		sources:         map[uint32]source{},
+		drained:         make(chan struct{}, 1),
+		writeDepth:      defaultQueueDepth,
+		dispatchDepth:   defaultQueueDepth,
+		dispatchPolicy:  QueueDropOldest,
+		ssrc:            rand.Uint32(),
+		cname:           fmt.Sprintf("%016x", rand.Uint64()),
+		log:             nopLogger{},
+		metrics:         nopMetrics{},
+	}
+	c.ctx, c.done = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.writeQ = newPacketQueue(c.writeDepth, c.writePolicy, c.ctx.Done(), c.dropWrite)
+	c.chain()
+	for _, fn := range c.onReady {
+		fn()
 	}
-
-	var ctx context.Context
-	ctx, c.done = context.WithCancel(context.Background())
-
-	go c.readPump()
-	go c.writePump(ctx)
-	go c.dispatchPump(ctx)
 	return c
 }
 
-type dispatchItem struct {
-	s Stream
-	p *Packet
+func (c *conn) start() {
+	ctx := c.ctx
+	go c.readPump()
+	go c.writePump(ctx)
+	if c.rtcpConn != nil {
+		go c.rtcpPump()
+	}
+	if c.reporting {
+		go c.reportPump(ctx)
+	}
+	if c.inactivity > 0 {
+		go c.expirePump(ctx)
+	}
 }
 
 type conn struct {
+	// badPackets is first to be 64-bit aligned for atomic access
+	badPackets uint64
+
+	// unsent counts the packets queued or being written, drained is
+	// signaled when it drops to 0
+	unsent  int32
+	drained chan struct{}
+
 	sync.Mutex
 	io.ReadWriteCloser
 	timeout time.Duration
 	streams map[uint32]Stream
 
-	writeCh    chan *Packet
-	dispatchCh chan dispatchItem
-	done       context.CancelFunc
-	closed     bool
+	writeQ         *packetQueue
+	workers        map[uint32]*worker
+	writeDepth     int
+	dispatchDepth  int
+	writePolicy    QueuePolicy
+	dispatchPolicy QueuePolicy
+	keyFrame       func(p *Packet) bool
+
+	ctx       context.Context
+	done      context.CancelFunc
+	closeOnce sync.Once
+	err       error
+	policy    ClosePolicy
+
+	// rtcpConn carries RTCP on a separate transport, nil means RTCP is
+	// multiplexed with RTP (RFC 5761)
+	rtcpConn    io.ReadWriteCloser
+	reporting   bool
+	bandwidth   float64
+	ssrc        uint32
+	cname       string
+	rtcpMutex   sync.Mutex
+	avgRTCPSize float64
+	members     map[uint32]time.Time
+	interval    time.Duration
+
+	interceptors []Interceptor
+	inbound      PacketHandler
+	outbound     PacketHandler
+	inboundRTCP  RTCPHandler
+	outboundRTCP RTCPHandler
+
+	parseMode  ParseMode
+	log        Logger
+	metrics    Metrics
+	streamOpts []StreamOption
+
+	// onReady run once the conn is built, onClose once it is closed and
+	// onRemove once a stream is removed
+	onReady  []func()
+	onClose  []func()
+	onRemove []func(ssrc uint32)
+
+	onStream  func(s Stream)
+	onRemoved func(s Stream, reason string)
+
+	// accept decides on the first packet of an unknown SSRC
+	accept     func(p *Packet) bool
+	inactivity time.Duration
+
+	// sources are the addresses of the received SSRCs and conflicts those
+	// of the collisions with our own (RFC 3550 8.2)
+	sourceMutex sync.Mutex
+	sources     map[uint32]source
+	conflicts   []source
+	onConflict  func(cf Conflict)
+}
+
+// worker dispatches the packets of a stream until stopped
+type worker struct {
+	q    *packetQueue
+	ctx  context.Context
+	stop context.CancelFunc
 }
 
 func (c *conn) Stream(ssrc uint32) Stream {
+	s, _ := c.stream(ssrc)
+	return s
+}
+
+// stream returns the stream of ssrc, created reports a new one
+func (c *conn) stream(ssrc uint32) (s Stream, created bool) {
+	c.Lock()
+	s = c.streams[ssrc]
+	created = s == nil
+	var w *worker
+	if created {
+		s = c.newStream(ssrc)
+		c.streams[ssrc] = s
+		w = &worker{}
+		w.ctx, w.stop = context.WithCancel(c.ctx)
+		w.q = newPacketQueue(c.dispatchDepth, c.dispatchPolicy, w.ctx.Done(), c.dropDispatch)
+		c.workers[ssrc] = w
+	}
+	c.Unlock()
+
+	if created {
+		go c.dispatchPump(s, w)
+		c.log.Info("stream created", "ssrc", ssrc)
+		for _, ic := range c.interceptors {
+			ic.BindStream(s)
+		}
+	}
+	return s, created
+}
+
+func (c *conn) OnStream(handler func(s Stream)) {
+	c.Lock()
+	c.onStream = handler
+	c.Unlock()
+}
+
+func (c *conn) Streams() []Stream {
+	return c.snapshot()
+}
+
+func (c *conn) RemoveStream(ssrc uint32) bool {
+	return c.removeStream(ssrc, "removed")
+}
+
+func (c *conn) OnStreamRemoved(handler func(s Stream, reason string)) {
+	c.Lock()
+	c.onRemoved = handler
+	c.Unlock()
+}
+
+// removeStream stops the worker of the stream of ssrc, closes the stream
+// and unbinds it
+func (c *conn) removeStream(ssrc uint32, reason string) bool {
 	c.Lock()
-	defer c.Unlock()
 	s := c.streams[ssrc]
+	w := c.workers[ssrc]
+	handler := c.onRemoved
+	delete(c.streams, ssrc)
+	delete(c.workers, ssrc)
+	c.Unlock()
+
 	if s == nil {
-		s = NewStream(ssrc, c.timeout, c.writePacket)
-		c.streams[ssrc] = s
+		return false
+	}
+	c.forgetSource(ssrc)
+	if w != nil {
+		w.stop()
+		w.q.release()
+	}
+	s.close()
+	for _, ic := range c.interceptors {
+		ic.UnbindStream(s)
+	}
+	for _, fn := range c.onRemove {
+		fn(ssrc)
+	}
+	c.log.Info("stream removed", "ssrc", ssrc, "reason", reason)
+	if handler != nil {
+		handler(s, reason)
 	}
+	return true
+}
+
+// expirePump removes the streams without a packet received or sent for the
+// inactivity timeout
+func (c *conn) expirePump(ctx context.Context) {
+	interval := c.inactivity / 2
+	if interval <= 0 {
+		interval = c.inactivity
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, s := range c.snapshot() {
+				if now.Sub(s.activity()) > c.inactivity {
+					c.removeStream(s.SSRC(), "inactive")
+				}
+			}
+		}
+	}
+}
+
+// newStream creates a stream sending through the outbound chain
+func (c *conn) newStream(ssrc uint32) Stream {
+	opts := make([]StreamOption, 0, len(c.streamOpts)+3)
+	opts = append(opts, withStreamMetrics(c.metrics), withStreamLogger(c.log), withStreamKeyFrame(c.keyFrame))
+	opts = append(opts, c.streamOpts...)
+
+	var s Stream
+	s = NewStream(ssrc, c.timeout, func(p *Packet) error {
+		return c.outbound(s, p)
+	}, opts...)
 	return s
 }
 
+// LocalAddr returns the local address of the transport, nil if unknown
+func (c *conn) LocalAddr() net.Addr {
+	if a, ok := c.ReadWriteCloser.(interface{ LocalAddr() net.Addr }); ok {
+		return a.LocalAddr()
+	}
+	return nil
+}
+
+// RemoteAddr returns the remote address of the transport, nil if unknown
+func (c *conn) RemoteAddr() net.Addr {
+	if a, ok := c.ReadWriteCloser.(interface{ RemoteAddr() net.Addr }); ok {
+		return a.RemoteAddr()
+	}
+	return nil
+}
+
 func (c *conn) readPump() {
-	var buff = make([]byte, 1500)
-	for !c.closed {
-		n, err := c.Read(buff)
+	if br, ok := c.ReadWriteCloser.(BatchReadWriter); ok {
+		c.readBatchPump(br)
+		return
+	}
+
+	if br, ok := c.ReadWriteCloser.(bufferReader); ok {
+		for {
+			b, n, err := br.readBuffer()
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			c.receive(b, n)
+		}
+	}
+
+	// framed transports carry packets larger than a datagram, their buffer
+	// is sized by the length of the next packet
+	sized, _ := c.ReadWriteCloser.(sizedReader)
+
+	for {
+		b, err := c.nextBuffer(sized)
 		if err != nil {
-			fmt.Print("read error: ", err)
-			break
+			c.fail(err)
+			return
 		}
 
-		p := &Packet{}
-		code := p.Decode(buff[:n])
-		if code < 0 {
-			fmt.Print("packet parse error: ", code)
-			break
+		n, err := c.Read(b.data)
+		if errors.Is(err, io.ErrShortBuffer) {
+			b.release()
+			c.dropOversized()
+			continue
+		}
+		if err != nil {
+			b.release()
+			c.fail(err)
+			return
 		}
 
-		ssrc := p.SSRC
+		c.receive(b, n)
+	}
+}
+
+// nextBuffer returns a receive buffer for the next packet of sized, or of a
+// datagram if nil
+func (c *conn) nextBuffer(sized sizedReader) (*packetBuffer, error) {
+	if sized == nil {
+		return newPacketBuffer(), nil
+	}
+	n, err := sized.nextPacketSize()
+	if err != nil {
+		return nil, err
+	}
+	return newSizedBuffer(n), nil
+}
+
+// dropOversized counts a packet too large for the receive buffers
+func (c *conn) dropOversized() {
+	atomic.AddUint64(&c.badPackets, 1)
+	c.metrics.ParseError()
+	c.log.Warn("packet too large")
+}
+
+// receive parses the first n bytes of b and queues the packet to the
+// dispatch of its stream, the packet owns b from then on. Malformed packets
+// are counted and dropped.
+func (c *conn) receive(b *packetBuffer, n int) {
+	if isRTCP(b.data[:n]) {
+		c.handleRTCP(b.data[:n])
+		b.release()
+		return
+	}
+
+	p, err := b.decode(n, c.parseMode)
+	if err != nil {
+		b.release()
+		atomic.AddUint64(&c.badPackets, 1)
+		c.metrics.ParseError()
+		c.log.Warn("packet parse failed", "err", err)
+		return
+	}
+	if c.accept != nil && c.lookup(p.SSRC) == nil && !c.accept(p) {
+		c.log.Debug("stream refused", "ssrc", p.SSRC, "pt", p.PT)
+		p.Release()
+		return
+	}
+	if !c.checkSource(p.SSRC, c.source()) {
+		p.Release()
+		return
+	}
+	c.metrics.PacketReceived(p.SSRC, n)
+
+	s, created := c.stream(p.SSRC)
+	if created {
 		c.Lock()
-		s := c.streams[ssrc]
-		if s == nil {
-			s = NewStream(ssrc, c.timeout, c.writePacket)
-			c.streams[ssrc] = s
-		}
+		handler := c.onStream
 		c.Unlock()
-
-		fmt.Println("packet seq: ", p.Seq)
-		c.dispatchCh <- dispatchItem{
-			s: s,
-			p: p,
+		if handler != nil {
+			handler(s)
 		}
 	}
+	// the packet is released by the inbound chain on error
+	ssrc := p.SSRC
+	if err := c.inbound(s, p); err != nil {
+		c.log.Warn("packet inbound failed", "ssrc", ssrc, "err", err)
+	}
 }
 
-func (c *conn) dispatchPump(ctx context.Context) {
+// enqueue ends the inbound chain, the packet is dispatched to its stream
+func (c *conn) enqueue(s Stream, p *Packet) error {
+	c.Lock()
+	w := c.workers[s.SSRC()]
+	c.Unlock()
+
+	if w == nil {
+		// a stream not created by the conn
+		c.dispatch(queueItem{s: s, p: p})
+		return nil
+	}
+
+	err := w.q.push(c.ctx, c.queueItem(s, p))
+	if err != nil {
+		p.Release()
+	}
+	return err
+}
+
+// dispatchPump dispatches the packets of a stream queue, every stream has
+// its own so that a slow stream does not hold up the others. It passes the
+// frames of s to its handlers, waking up for the frame timeouts.
+func (c *conn) dispatchPump(s Stream, w *worker) {
+	var wait time.Duration
 	for {
-		select {
-		case <-ctx.Done():
+		d, ok := w.q.poll(w.ctx, wait)
+		if ok {
+			c.dispatch(d)
+		} else if w.ctx.Err() != nil {
 			return
+		}
+		wait = s.deliver(time.Now())
+	}
+}
 
-		case d := <-c.dispatchCh:
-			err := d.s.dispatch(d.p)
-			if err != nil {
-				fmt.Println("stream dispatch error: ", err)
-			}
+func (c *conn) dispatch(d queueItem) {
+	err := d.s.dispatch(d.p)
+	if err != nil {
+		d.p.Release()
+		reason := Deny
+		var de *DenyError
+		if errors.As(err, &de) {
+			reason = de.Reason
 		}
+		c.metrics.DispatchDenied(d.s.SSRC(), reason)
+		c.log.Debug("packet denied", "ssrc", d.s.SSRC(), "reason", reason, "err", err)
 	}
 }
 
-func (c *conn) writePacket(p *Packet) error {
-	if c.closed {
-		return errors.New("udp conn closed")
+// queuedDispatch returns the number of packets queued for the streams
+func (c *conn) queuedDispatch() int {
+	c.Lock()
+	defer c.Unlock()
+
+	n := 0
+	for _, w := range c.workers {
+		n += w.q.len()
+	}
+	return n
+}
+
+func (c *conn) writePacket(s Stream, p *Packet) error {
+	if c.isClosed() {
+		p.Release()
+		return ErrClosed
+	}
+
+	// a blocked write gives up with the context of WriteFrameContext
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	atomic.AddInt32(&c.unsent, 1)
+	if err := c.writeQ.push(ctx, c.queueItem(s, p)); err != nil {
+		c.sent(1)
+		p.Release()
+		return err
 	}
-	c.writeCh <- p
 	return nil
 }
 
+func (c *conn) queueItem(s Stream, p *Packet) queueItem {
+	item := queueItem{s: s, p: p}
+	if c.keyFrame != nil {
+		item.key = c.keyFrame(p)
+	}
+	return item
+}
+
+func (c *conn) dropWrite(item queueItem) {
+	c.sent(1)
+	c.metrics.PacketDropped(item.p.SSRC, "write")
+	item.p.Release()
+}
+
+func (c *conn) dropDispatch(item queueItem) {
+	c.metrics.PacketDropped(item.p.SSRC, "dispatch")
+	c.log.Debug("packet dropped", "ssrc", item.p.SSRC, "seq", item.p.Seq, "queue", "dispatch")
+	item.p.Release()
+}
+
+func (c *conn) isClosed() bool {
+	select {
+	case <-c.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *conn) writePump(ctx context.Context) {
-	defer c.Close()
+	if bw, ok := c.ReadWriteCloser.(BatchReadWriter); ok {
+		c.writeBatchPump(ctx, bw)
+		return
+	}
 
+	buf := make([]byte, maxDatagramSize)
 	for {
+		item, ok := c.writeQ.pop(ctx)
+		if !ok {
+			return
+		}
+
+		var data []byte
+		ssrc := item.p.SSRC
+		data, buf = marshalPacket(item.p, buf)
+		_, err := c.Write(data)
+		c.sent(1)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.metrics.PacketSent(ssrc, len(data))
+	}
+}
+
+// marshalPacket encodes and releases p, buf is grown if too small
+func marshalPacket(p *Packet, buf []byte) ([]byte, []byte) {
+	if size := p.MarshalSize(); size > len(buf) {
+		buf = make([]byte, size)
+	}
+
+	n, _ := p.MarshalTo(buf)
+	p.Release()
+	return buf[:n], buf
+}
+
+// Close closes the Conn, with CloseDrain queued packets are sent for up to
+// the timeout of the Conn
+func (c *conn) Close() error {
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return c.CloseWithContext(ctx)
+}
+
+func (c *conn) CloseWithContext(ctx context.Context) error {
+	if c.policy == CloseDrain && !c.isClosed() {
+		c.drain(ctx)
+	}
+	return c.closeWith(ErrClosed)
+}
+
+// drain waits until the queued packets are written or ctx is done
+func (c *conn) drain(ctx context.Context) {
+	for atomic.LoadInt32(&c.unsent) > 0 {
 		select {
 		case <-ctx.Done():
 			return
+		case <-c.ctx.Done():
+			return
+		case <-c.drained:
+		}
+	}
+}
 
-		case p := <-c.writeCh:
-			data := p.Encode()
-			_, err := c.Write(data)
-			if err != nil {
+// sent counts n packets written or dropped from the write queue
+func (c *conn) sent(n int) {
+	if atomic.AddInt32(&c.unsent, -int32(n)) == 0 {
+		signal(c.drained)
+	}
+}
 
-				return
+// fail closes the conn after a transport error of a pump
+func (c *conn) fail(err error) {
+	if c.isClosed() {
+		return
+	}
+	c.log.Error("conn failed", "err", err)
+	c.closeWith(err)
+}
+
+// closeWith closes the conn once with cause, blocked calls return ErrClosed
+// and queued packets are released.
+func (c *conn) closeWith(cause error) error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.Lock()
+		c.err = cause
+		c.Unlock()
+		c.done()
+
+		for _, s := range c.snapshot() {
+			s.close()
+			for _, ic := range c.interceptors {
+				ic.UnbindStream(s)
 			}
 		}
-	}
+		c.log.Info("conn closed", "remote", c.RemoteAddr(), "cause", cause)
+		for _, fn := range c.onClose {
+			fn()
+		}
+
+		if c.rtcpConn != nil {
+			c.rtcpConn.Close()
+		}
+		err = c.ReadWriteCloser.Close()
+		c.discard()
+	})
+	return err
 }
 
-func (c *conn) Close() error {
-	if c.closed {
-		return nil
+// discard releases the packets left in the queues
+func (c *conn) discard() {
+	for {
+		item, ok := c.writeQ.tryPop()
+		if !ok {
+			break
+		}
+		c.sent(1)
+		item.p.Release()
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	for _, w := range c.workers {
+		w.q.release()
 	}
-	c.closed = true
-	c.done()
-	return c.ReadWriteCloser.Close()
+}
+
+func (c *conn) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+func (c *conn) Err() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.err
 }
@@ -1,7 +1,11 @@
 package rtp
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,3 +32,273 @@ func TestClient(t *testing.T) {
 
 	t.Log("write frame data: ", n)
 }
+
+type blockingConn struct {
+	*datagramConn
+	written chan []byte
+}
+
+func (bc *blockingConn) Write(data []byte) (int, error) {
+	select {
+	case bc.written <- append([]byte{}, data...):
+		return len(data), nil
+	case <-bc.closed:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	bc := &blockingConn{datagramConn: newDatagramConn(), written: make(chan []byte)}
+	c := NewConn(bc, time.Second, WithWriteQueue(1))
+	s := c.Stream(1234)
+
+	readErr := make(chan error)
+	go func() {
+		_, err := s.ReadFrame(context.Background())
+		readErr <- err
+	}()
+
+	// the pump blocks on the first packet and the second fills the queue
+	writeErr := make(chan error)
+	go func() {
+		for i := 0; i < 3; i++ {
+			if _, err := s.WriteFrame([]byte{byte(i)}, 96, 3000, nil); err != nil {
+				writeErr <- err
+				return
+			}
+		}
+		writeErr <- nil
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	assert.Nil(t, c.Err())
+	assert.Nil(t, c.Close())
+	<-c.Done()
+	assert.ErrorIs(t, c.Err(), ErrClosed)
+	assert.ErrorIs(t, <-readErr, ErrClosed)
+	assert.ErrorIs(t, <-writeErr, ErrClosed)
+
+	_, err := s.WriteFrame([]byte{1}, 96, 3000, nil)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestConnDrain(t *testing.T) {
+	bc := &blockingConn{datagramConn: newDatagramConn(), written: make(chan []byte, 10)}
+	c := NewConn(bc, time.Second, WithClosePolicy(CloseDrain))
+	for i := 0; i < 5; i++ {
+		c.Stream(1234).WriteFrame([]byte{byte(i)}, 96, 3000, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, c.CloseWithContext(ctx))
+	assert.Equal(t, 5, len(bc.written))
+
+	// a stalled writer holds up Close for the timeout of the Conn only
+	bc = &blockingConn{datagramConn: newDatagramConn(), written: make(chan []byte)}
+	c = NewConn(bc, 50*time.Millisecond, WithClosePolicy(CloseDrain))
+	c.Stream(1234).WriteFrame([]byte{1}, 96, 3000, nil)
+	closed := make(chan error)
+	go func() {
+		closed <- c.Close()
+	}()
+	select {
+	case err := <-closed:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Error("close not bounded by the timeout")
+	}
+
+	// a transport failure is the terminal cause
+	dc := newDatagramConn()
+	c = NewConn(dc, time.Second)
+	dc.Close()
+	<-c.Done()
+	assert.ErrorIs(t, c.Err(), io.EOF)
+}
+
+func TestStreamIsolation(t *testing.T) {
+	dc := newDatagramConn()
+	c := NewConn(dc, 50*time.Millisecond)
+	defer c.Close()
+
+	// nobody reads the frames of 1111, which used to block every stream
+	for i := 1; i <= 20; i++ {
+		for _, ssrc := range []uint32{1111, 2222} {
+			p := &Packet{Seq: uint16(i), Timestamp: uint32(i * 3000), SSRC: ssrc, Marker: 1, Payload: []byte{byte(i)}}
+			dc.readCh <- p.Encode()
+		}
+	}
+
+	s := c.Stream(2222)
+	for i := 1; i <= 20; i++ {
+		f, err := s.ReadFrame(context.Background())
+		assert.Equal(t, []byte{byte(i)}, f.First().Payload)
+		if i > 1 {
+			assert.Nil(t, err)
+		}
+		f.Release()
+	}
+}
+
+func TestStreamHandlerBlocked(t *testing.T) {
+	dc := newDatagramConn()
+	cm := &countMetrics{}
+	c := NewConn(dc, 50*time.Millisecond, WithMetrics(cm))
+	defer c.Close()
+
+	// the handler of 1111 never returns, which used to stall the receive path
+	// once its dispatch queue was full
+	block := make(chan struct{})
+	defer close(block)
+	c.Stream(1111).OnPacket(func(p *Packet) {
+		<-block
+	})
+
+	for i := 1; i <= 2*defaultQueueDepth; i++ {
+		p := &Packet{Seq: uint16(i), Timestamp: uint32(i * 3000), SSRC: 1111, Marker: 1, Payload: []byte{byte(i)}}
+		dc.readCh <- p.Encode()
+	}
+	for i := 1; i <= 20; i++ {
+		p := &Packet{Seq: uint16(i), Timestamp: uint32(i * 3000), SSRC: 2222, Marker: 1, Payload: []byte{byte(i)}}
+		dc.readCh <- p.Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s := c.Stream(2222)
+	for i := 1; i <= 20; i++ {
+		f, err := s.ReadFrame(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{byte(i)}, f.First().Payload)
+		f.Release()
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	assert.Less(t, 0, cm.packetsDropped["dispatch"])
+}
+
+func TestStreamHandlers(t *testing.T) {
+	dc := newDatagramConn()
+	c := NewConn(dc, 30*time.Millisecond)
+	defer c.Close()
+
+	var (
+		mutex    sync.Mutex
+		streams  []uint32
+		packets  []uint16
+		frames   []uint32
+		timeouts []uint32
+	)
+	c.OnStream(func(s Stream) {
+		mutex.Lock()
+		streams = append(streams, s.SSRC())
+		mutex.Unlock()
+
+		s.OnPacket(func(p *Packet) {
+			mutex.Lock()
+			packets = append(packets, p.Seq)
+			mutex.Unlock()
+		})
+		s.OnFrame(func(f *Frame) {
+			mutex.Lock()
+			frames = append(frames, f.Timestamp())
+			mutex.Unlock()
+			f.Release()
+		})
+		s.OnTimeout(func(f *Frame) {
+			mutex.Lock()
+			timeouts = append(timeouts, f.Timestamp())
+			mutex.Unlock()
+			f.Release()
+		})
+	})
+
+	// the second frame misses its marker and times out
+	for _, p := range []*Packet{
+		{Seq: 1, Timestamp: 0, Marker: 1},
+		{Seq: 2, Timestamp: 3000},
+		{Seq: 3, Timestamp: 6000, Marker: 1},
+	} {
+		p.SSRC = 1234
+		p.Payload = []byte{1}
+		dc.readCh <- p.Encode()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []uint32{1234}, streams)
+	assert.Equal(t, []uint16{1, 2, 3}, packets)
+	assert.Equal(t, []uint32{0, 6000}, frames)
+	assert.Equal(t, []uint32{3000}, timeouts)
+}
+
+func TestStreamManagement(t *testing.T) {
+	dc := newDatagramConn()
+	c := NewConn(dc, time.Second,
+		WithAccept(func(p *Packet) bool {
+			return p.PT == 96
+		}),
+		WithInactivityTimeout(50*time.Millisecond))
+	defer c.Close()
+
+	var (
+		mutex   sync.Mutex
+		removed []string
+	)
+	c.OnStreamRemoved(func(s Stream, reason string) {
+		mutex.Lock()
+		removed = append(removed, fmt.Sprint(s.SSRC(), " ", reason))
+		mutex.Unlock()
+	})
+	send := func(ssrc uint32, pt byte) {
+		p := &Packet{Seq: 1, Timestamp: 0, SSRC: ssrc, PT: pt, Marker: 1, Payload: []byte{1}}
+		dc.readCh <- p.Encode()
+	}
+
+	// the payload type 0 is refused
+	send(1, 96)
+	send(2, 0)
+	time.Sleep(20 * time.Millisecond)
+	streams := c.Streams()
+	assert.Equal(t, 1, len(streams))
+	assert.Equal(t, uint32(1), streams[0].SSRC())
+
+	assert.True(t, c.RemoveStream(1))
+	assert.False(t, c.RemoveStream(1))
+	_, err := streams[0].ReadFrame(context.Background())
+	assert.Equal(t, ErrClosed, err)
+
+	send(3, 96)
+	dc.readCh <- EncodeRTCP(&Goodbye{Sources: []uint32{3}})
+	time.Sleep(20 * time.Millisecond)
+
+	send(4, 96)
+	time.Sleep(150 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"1 removed", "3 bye", "4 inactive"}, removed)
+	assert.Empty(t, c.Streams())
+}
+
+func TestGoodbyeLocalSender(t *testing.T) {
+	dc := newDatagramConn()
+	c := NewConn(dc, time.Second)
+	defer c.Close()
+
+	s := c.Stream(1234)
+	_, err := s.WriteFrame([]byte{1}, 96, 3000, nil)
+	assert.Nil(t, err)
+	dc.readCh <- (&Packet{Seq: 1, SSRC: 5678, Marker: 1, Payload: []byte{1}}).Encode()
+
+	// a peer can not remove our sender
+	dc.readCh <- EncodeRTCP(&Goodbye{Sources: []uint32{1234, 5678}})
+	time.Sleep(20 * time.Millisecond)
+
+	streams := c.Streams()
+	assert.Equal(t, 1, len(streams))
+	assert.Equal(t, s, streams[0])
+}
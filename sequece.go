@@ -21,6 +21,13 @@ func NewRandomSequencer() Sequencer {
 	}
 }
 
+// NewSequencer returns a Sequencer starting at first
+func NewSequencer(first uint16) Sequencer {
+	return &sequence{
+		counter: first - 1,
+	}
+}
+
 type sequence struct {
 	rwmutex sync.RWMutex
 	counter uint16
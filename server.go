@@ -0,0 +1,377 @@
+package rtp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdleTimeout = 30 * time.Second
+	defaultBacklog     = 16
+	maxDatagramSize    = 1500
+)
+
+var ErrSessionClosed = errors.New("rtp session closed")
+
+// ListenConfig contains options for listening to RTP sessions
+type ListenConfig struct {
+	// Timeout is the frame read timeout of accepted Conns
+	Timeout time.Duration
+
+	// IdleTimeout closes sessions without incoming packets, 0 means 30s and
+	// a negative value disables eviction
+	IdleTimeout time.Duration
+
+	// MaxConns limits the number of live sessions, 0 means no limit
+	MaxConns int
+
+	// DemuxBySSRC keys sessions by SSRC instead of remote address, the send
+	// address follows the latest source address of the SSRC which keeps NATed
+	// peers working across rebinding
+	DemuxBySSRC bool
+
+	// Backlog is the number of sessions waiting for Accept, 0 means 16
+	Backlog int
+
+	// Options configure every accepted Conn, such as WithInterceptors
+	Options []ConnOption
+}
+
+// Listen announces on the local UDP address and demultiplexes incoming
+// packets into a Conn per remote peer.
+func Listen(network, addr string) (*Listener, error) {
+	var lc ListenConfig
+	return lc.Listen(network, addr)
+}
+
+func (lc *ListenConfig) Listen(network, addr string) (*Listener, error) {
+	laddr, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		config:   *lc,
+		pc:       pc,
+		sessions: map[string]*session{},
+		acceptCh: make(chan Conn, lc.backlog()),
+		done:     make(chan struct{}),
+	}
+
+	go l.readPump()
+	if l.config.idleTimeout() > 0 {
+		go l.evictPump()
+	}
+	return l, nil
+}
+
+func (lc *ListenConfig) idleTimeout() time.Duration {
+	if lc.IdleTimeout == 0 {
+		return defaultIdleTimeout
+	}
+	return lc.IdleTimeout
+}
+
+func (lc *ListenConfig) backlog() int {
+	if lc.Backlog <= 0 {
+		return defaultBacklog
+	}
+	return lc.Backlog
+}
+
+type Listener struct {
+	config ListenConfig
+	pc     *net.UDPConn
+
+	mutex    sync.Mutex
+	sessions map[string]*session
+
+	acceptCh  chan Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for the first packet of a new peer and returns its Conn
+func (l *Listener) Accept() (Conn, error) {
+	select {
+	case c := <-l.acceptCh:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+// Close stops accepting sessions, closes every live session and the socket.
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.pc.Close()
+
+		l.mutex.Lock()
+		sessions := make([]*session, 0, len(l.sessions))
+		for _, s := range l.sessions {
+			sessions = append(sessions, s)
+		}
+		l.mutex.Unlock()
+
+		for _, s := range sessions {
+			s.conn.Close()
+		}
+
+		for {
+			select {
+			case c := <-l.acceptCh:
+				c.Close()
+			default:
+				return
+			}
+		}
+	})
+	return err
+}
+
+func (l *Listener) readPump() {
+	defer l.Close()
+
+	// a datagram is up to 65535 octets, it is copied into a pooled buffer
+	// of its size class owned by the session
+	buf := make([]byte, maxFrameSize)
+	for {
+		n, addr, err := l.pc.ReadFromUDP(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		if shortPacket(buf[:n]) {
+			continue
+		}
+
+		s := l.session(l.sessionKey(buf[:n], addr), addr)
+		if s == nil {
+			continue
+		}
+		b := newSizedBuffer(n)
+		copy(b.data, buf[:n])
+		s.push(b, n, addr)
+	}
+}
+
+func (l *Listener) sessionKey(data []byte, addr *net.UDPAddr) string {
+	if l.config.DemuxBySSRC {
+		if isRTCP(data) {
+			return string(data[4:8])
+		}
+		return string(data[8:12])
+	}
+	return addr.String()
+}
+
+func (l *Listener) session(key string, addr *net.UDPAddr) *session {
+	l.mutex.Lock()
+	if s := l.sessions[key]; s != nil {
+		l.mutex.Unlock()
+		return s
+	}
+
+	if l.config.MaxConns > 0 && len(l.sessions) >= l.config.MaxConns {
+		l.mutex.Unlock()
+		return nil
+	}
+
+	s := &session{
+		l:      l,
+		key:    key,
+		addr:   addr,
+		readCh: make(chan datagram, 100),
+		closed: make(chan struct{}),
+	}
+	s.touch()
+	s.conn = NewConn(s, l.config.Timeout, l.config.Options...)
+	l.sessions[key] = s
+
+	select {
+	case l.acceptCh <- s.conn:
+		l.mutex.Unlock()
+		return s
+	default:
+	}
+	l.mutex.Unlock()
+
+	// backlog full, the peer retries with its next packet
+	s.conn.Close()
+	return nil
+}
+
+func (l *Listener) remove(s *session) {
+	l.mutex.Lock()
+	if l.sessions[s.key] == s {
+		delete(l.sessions, s.key)
+	}
+	l.mutex.Unlock()
+}
+
+func (l *Listener) evictPump() {
+	timeout := l.config.idleTimeout()
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+
+		case now := <-ticker.C:
+			var idle []*session
+			l.mutex.Lock()
+			for _, s := range l.sessions {
+				if now.Sub(s.lastActive()) > timeout {
+					idle = append(idle, s)
+				}
+			}
+			l.mutex.Unlock()
+
+			for _, s := range idle {
+				s.conn.Close()
+			}
+		}
+	}
+}
+
+// session is the datagram oriented io.ReadWriteCloser of a single peer
+type session struct {
+	l    *Listener
+	key  string
+	conn Conn
+
+	mutex  sync.Mutex
+	addr   *net.UDPAddr
+	active int64
+
+	readCh    chan datagram
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// source of the last packet read
+	source net.Addr
+}
+
+// datagram is a packet of n octets in b pushed to a session and its source
+type datagram struct {
+	b    *packetBuffer
+	n    int
+	addr *net.UDPAddr
+}
+
+// push queues the packet of n octets in b, the session owns b from then on
+func (s *session) push(b *packetBuffer, n int, addr *net.UDPAddr) {
+	s.mutex.Lock()
+	s.addr = addr
+	s.mutex.Unlock()
+	s.touch()
+
+	select {
+	case s.readCh <- datagram{b: b, n: n, addr: addr}:
+	default:
+		// reader is behind, drop like a full socket buffer would
+		b.release()
+	}
+}
+
+func (s *session) touch() {
+	s.mutex.Lock()
+	s.active = time.Now().UnixNano()
+	s.mutex.Unlock()
+}
+
+func (s *session) lastActive() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return time.Unix(0, s.active)
+}
+
+func (s *session) Read(buf []byte) (int, error) {
+	b, n, err := s.readBuffer()
+	if err != nil {
+		return 0, err
+	}
+	defer b.release()
+
+	if n > len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(buf, b.data[:n]), nil
+}
+
+// readBuffer hands over the next packet without a copy
+func (s *session) readBuffer() (*packetBuffer, int, error) {
+	select {
+	case d := <-s.readCh:
+		s.source = d.addr
+		return d.b, d.n, nil
+	case <-s.closed:
+		return nil, 0, ErrSessionClosed
+	}
+}
+
+func (s *session) Write(data []byte) (int, error) {
+	select {
+	case <-s.closed:
+		return 0, ErrSessionClosed
+	default:
+	}
+	return s.l.pc.WriteToUDP(data, s.RemoteAddr().(*net.UDPAddr))
+}
+
+func (s *session) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.l.remove(s)
+	})
+	return nil
+}
+
+func (s *session) sourceAddr() net.Addr {
+	return s.source
+}
+
+func (s *session) LocalAddr() net.Addr {
+	return s.l.pc.LocalAddr()
+}
+
+func (s *session) RemoteAddr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.addr
+}
+
+// shortPacket reports whether data can not hold the header of a RTP packet,
+// or that of a RTCP packet up to the sender SSRC such as an empty receiver
+// report
+func shortPacket(data []byte) bool {
+	if isRTCP(data) {
+		return len(data) < rtcpHeaderSize+4
+	}
+	return len(data) < FixedHeaderSize
+}
+
+// isRTCP reports whether a multiplexed packet is RTCP (RFC 5761)
+func isRTCP(data []byte) bool {
+	return len(data) >= 2 && data[1] >= 192 && data[1] <= 223
+}
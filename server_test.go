@@ -0,0 +1,113 @@
+package rtp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListener(t *testing.T) {
+	lc := ListenConfig{
+		Timeout:     time.Second,
+		IdleTimeout: 100 * time.Millisecond,
+		MaxConns:    1,
+	}
+	l, err := lc.Listen("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	client, err := net.DialUDP("udp", nil, l.Addr().(*net.UDPAddr))
+	assert.Nil(t, err)
+	defer client.Close()
+
+	other, err := net.DialUDP("udp", nil, l.Addr().(*net.UDPAddr))
+	assert.Nil(t, err)
+	defer other.Close()
+
+	p := &Packet{Seq: 1, Timestamp: 3000, SSRC: 1234, Marker: 1, Payload: []byte{1, 2, 3}}
+	_, err = client.Write(p.Encode())
+	assert.Nil(t, err)
+
+	c, err := l.Accept()
+	assert.Nil(t, err)
+	assert.Equal(t, client.LocalAddr().String(), c.RemoteAddr().String())
+
+	// over the connection limit
+	_, err = other.Write(p.Encode())
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	f, err := c.Stream(1234).ReadFrame(ctx)
+	assert.NotNil(t, f)
+	assert.Equal(t, uint32(3000), f.Timestamp())
+
+	// idle eviction frees the slot for the other peer
+	time.Sleep(300 * time.Millisecond)
+	_, err = other.Write(p.Encode())
+	assert.Nil(t, err)
+
+	c, err = l.Accept()
+	assert.Nil(t, err)
+	assert.Equal(t, other.LocalAddr().String(), c.RemoteAddr().String())
+}
+
+func TestListenerShortRTCP(t *testing.T) {
+	l, err := Listen("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	client, err := net.DialUDP("udp", nil, l.Addr().(*net.UDPAddr))
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// an empty receiver report multiplexed with RTP (RFC 5761)
+	rr := (&ReceiverReport{SSRC: 1234}).Encode()
+	assert.Equal(t, 8, len(rr))
+	_, err = client.Write(rr)
+	assert.Nil(t, err)
+
+	accepted := make(chan Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	select {
+	case c := <-accepted:
+		assert.Equal(t, client.LocalAddr().String(), c.RemoteAddr().String())
+	case <-time.After(time.Second):
+		t.Fatal("rtcp packet dropped")
+	}
+}
+
+func TestListenerLargeDatagram(t *testing.T) {
+	l, err := Listen("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	client, err := net.DialUDP("udp", nil, l.Addr().(*net.UDPAddr))
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// larger than maxDatagramSize, such as over a jumbo frame link
+	p := &Packet{Seq: 1, Timestamp: 3000, SSRC: 1234, Marker: 1, Payload: make([]byte, 4000)}
+	_, err = client.Write(p.Encode())
+	assert.Nil(t, err)
+
+	c, err := l.Accept()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	f, err := c.Stream(1234).ReadFrame(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 4000, f.Len())
+	assert.Equal(t, jumboBufferSize, len(f.First().buf.data))
+	f.Release()
+}
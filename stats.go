@@ -0,0 +1,296 @@
+package rtp
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultClockRate = 90000
+
+// ntpEpochOffset is the number of seconds between 1900 and 1970
+const ntpEpochOffset = 2208988800
+
+func toNTPTime(t time.Time) uint64 {
+	nsec := uint64(t.UnixNano())
+	sec := nsec/1e9 + ntpEpochOffset
+	frac := (nsec % 1e9 << 32) / 1e9
+	return sec<<32 | frac
+}
+
+func fromNTPTime(ntp uint64) time.Time {
+	sec := int64(ntp>>32) - ntpEpochOffset
+	nsec := int64((ntp & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// middleNTP is the compact NTP format used by LSR and DLSR
+func middleNTP(ntp uint64) uint32 {
+	return uint32(ntp >> 16)
+}
+
+// receiverStats keeps the reception statistics of a remote source (RFC 3550 A.1, A.3, A.8)
+type receiverStats struct {
+	mutex sync.Mutex
+
+	clockRate   uint32
+	initialized bool
+
+	baseSeq  uint16
+	maxSeq   uint16
+	cycles   uint32
+	received uint32
+
+	expectedPrior uint32
+	receivedPrior uint32
+
+	epoch   time.Time
+	transit uint32
+	jitter  float64
+
+	lastSR     uint32
+	lastSRTime time.Time
+	lastPacket time.Time
+
+	// lastTimestamp is that of the last packet, srNTP and srRTP map the
+	// RTP timestamps to the wall clock of the sender from the latest SR
+	lastTimestamp uint32
+	srNTP         uint64
+	srRTP         uint32
+	hasSR         bool
+}
+
+func (rs *receiverStats) update(p *Packet, arrival time.Time) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if !rs.initialized {
+		rs.initialized = true
+		rs.epoch = arrival
+		rs.baseSeq = p.Seq
+		rs.maxSeq = p.Seq
+	} else if compareSequence(p.Seq, rs.maxSeq) > 0 {
+		if p.Seq < rs.maxSeq {
+			rs.cycles += 1 << 16
+		}
+		rs.maxSeq = p.Seq
+	}
+	rs.received += 1
+	rs.lastPacket = arrival
+	rs.lastTimestamp = p.Timestamp
+
+	clockRate := rs.clockRate
+	if clockRate == 0 {
+		clockRate = defaultClockRate
+	}
+
+	// interarrival jitter in timestamp units
+	ts := int64(arrival.Sub(rs.epoch).Seconds() * float64(clockRate))
+	transit := uint32(ts) - p.Timestamp
+	if rs.received > 1 {
+		d := int32(transit - rs.transit)
+		if d < 0 {
+			d = -d
+		}
+		rs.jitter += (float64(d) - rs.jitter) / 16
+	}
+	rs.transit = transit
+}
+
+func (rs *receiverStats) onSenderReport(ntp uint64, rtp uint32, arrival time.Time) {
+	rs.mutex.Lock()
+	rs.lastSR = middleNTP(ntp)
+	rs.lastSRTime = arrival
+	rs.srNTP = ntp
+	rs.srRTP = rtp
+	rs.hasSR = true
+	rs.mutex.Unlock()
+}
+
+// wallClock maps an RTP timestamp to the wall clock of the sender, false
+// until a sender report is received
+func (rs *receiverStats) wallClock(timestamp uint32) (time.Time, bool) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.wallClockLocked(timestamp)
+}
+
+func (rs *receiverStats) wallClockLocked(timestamp uint32) (time.Time, bool) {
+	if !rs.hasSR {
+		return time.Time{}, false
+	}
+
+	clockRate := rs.clockRate
+	if clockRate == 0 {
+		clockRate = defaultClockRate
+	}
+	d := int64(int32(timestamp-rs.srRTP)) * int64(time.Second) / int64(clockRate)
+	return fromNTPTime(rs.srNTP).Add(time.Duration(d)), true
+}
+
+// delay returns the time from the capture of the last packet to its
+// arrival, offset by the difference of the sender and local clocks
+func (rs *receiverStats) delay() (time.Duration, bool) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if !rs.initialized {
+		return 0, false
+	}
+	capture, ok := rs.wallClockLocked(rs.lastTimestamp)
+	if !ok {
+		return 0, false
+	}
+	return rs.lastPacket.Sub(capture), true
+}
+
+// report builds the reception report block and starts a new report interval
+func (rs *receiverStats) report(ssrc uint32, now time.Time) (ReceptionReport, bool) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if !rs.initialized {
+		return ReceptionReport{}, false
+	}
+
+	extended := rs.cycles + uint32(rs.maxSeq)
+	expected := extended - uint32(rs.baseSeq) + 1
+	lost := int64(expected) - int64(rs.received)
+	if lost < 0 {
+		lost = 0
+	} else if lost > 0x7fffff {
+		lost = 0x7fffff
+	}
+
+	expectedInterval := expected - rs.expectedPrior
+	receivedInterval := rs.received - rs.receivedPrior
+	rs.expectedPrior = expected
+	rs.receivedPrior = rs.received
+
+	var fraction byte
+	if lostInterval := int64(expectedInterval) - int64(receivedInterval); expectedInterval > 0 && lostInterval > 0 {
+		fraction = byte(lostInterval << 8 / int64(expectedInterval))
+	}
+
+	r := ReceptionReport{
+		SSRC:         ssrc,
+		FractionLost: fraction,
+		TotalLost:    uint32(lost),
+		HighestSeq:   extended,
+		Jitter:       uint32(rs.jitter),
+	}
+	if !rs.lastSRTime.IsZero() {
+		r.LastSR = rs.lastSR
+		r.DelaySinceLastSR = uint32(now.Sub(rs.lastSRTime) * 65536 / time.Second)
+	}
+	return r, true
+}
+
+// quality returns the interarrival jitter in seconds and the cumulative
+// number of packets lost, ok is false before the first packet
+func (rs *receiverStats) quality() (jitter float64, lost int64, ok bool) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if !rs.initialized {
+		return 0, 0, false
+	}
+
+	clockRate := rs.clockRate
+	if clockRate == 0 {
+		clockRate = defaultClockRate
+	}
+	expected := rs.cycles + uint32(rs.maxSeq) - uint32(rs.baseSeq) + 1
+	return rs.jitter / float64(clockRate), int64(expected) - int64(rs.received), true
+}
+
+// member reports whether the source has sent any packet
+func (rs *receiverStats) member() bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.initialized
+}
+
+// last returns the arrival of the last packet
+func (rs *receiverStats) last() time.Time {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.lastPacket
+}
+
+// active reports whether packets were received since the previous report
+func (rs *receiverStats) active() bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.initialized && rs.received != rs.receivedPrior
+}
+
+// senderStats keeps the sender information of a local source
+type senderStats struct {
+	mutex sync.Mutex
+
+	clockRate     uint32
+	packetCount   uint32
+	octetCount    uint32
+	lastTimestamp uint32
+	lastSend      time.Time
+	reported      uint32
+}
+
+func (ss *senderStats) update(timestamp uint32, size int, now time.Time) {
+	ss.mutex.Lock()
+	ss.packetCount += 1
+	ss.octetCount += uint32(size)
+	ss.lastTimestamp = timestamp
+	ss.lastSend = now
+	ss.mutex.Unlock()
+}
+
+// last returns the time of the last packet sent
+func (ss *senderStats) last() time.Time {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.lastSend
+}
+
+// sent reports whether any packet was sent
+func (ss *senderStats) sent() bool {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.packetCount > 0
+}
+
+// padding counts a padding-only packet, it carries no payload octets nor
+// a new sampling instant
+func (ss *senderStats) padding() {
+	ss.mutex.Lock()
+	ss.packetCount += 1
+	ss.mutex.Unlock()
+}
+
+// active reports whether packets were sent since the previous report
+func (ss *senderStats) active() bool {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.packetCount != ss.reported
+}
+
+func (ss *senderStats) report(ssrc uint32, now time.Time) *SenderReport {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	clockRate := ss.clockRate
+	if clockRate == 0 {
+		clockRate = defaultClockRate
+	}
+
+	// extrapolate the RTP timestamp of the report from the last packet
+	elapsed := now.Sub(ss.lastSend)
+	ss.reported = ss.packetCount
+	return &SenderReport{
+		SSRC:        ssrc,
+		NTPTime:     toNTPTime(now),
+		RTPTime:     ss.lastTimestamp + uint32(elapsed.Seconds()*float64(clockRate)),
+		PacketCount: ss.packetCount,
+		OctetCount:  ss.octetCount,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,19 +22,144 @@ type Stream interface {
 	dispatch(p *Packet) error
 	ReadFrame(ctx context.Context) (*Frame, error)
 	WriteFrame(payload []byte, typ byte, samples uint32, csrc []uint32) (int, error)
+	WriteFrameContext(ctx context.Context, payload []byte, typ byte, samples uint32, csrc []uint32) (int, error)
+	WritePadding(size int) error
+
+	// ReadPacket returns the next received packet with FrameNone, the
+	// caller owns it and must Release it
+	ReadPacket(ctx context.Context) (*Packet, error)
+
+	// WritePacket sends a packetized payload as is but for its SSRC and,
+	// with WithRewrite, its sequence number and timestamp. The stream owns
+	// p from then on.
+	WritePacket(p *Packet) error
 	SkipSamples(uint32)
 	SSRC() uint32
+	PlayoutDelay() time.Duration
+
+	// OnFrame sets a handler called with every frame on the dispatch worker
+	// instead of ReadFrame. Frames are passed once complete or, with
+	// IncompletePartial, timed out, regardless of WithJitterBuffer.
+	OnFrame(handler func(f *Frame))
+
+	// OnPacket sets a handler called with every received packet on the
+	// dispatch worker before it is assembled, call Retain to keep it
+	OnPacket(handler func(p *Packet))
+
+	// OnTimeout sets a handler called with the frames incomplete after the
+	// read timeout with IncompleteWait, they are released without one
+	OnTimeout(handler func(f *Frame))
+
+	// OnSSRCChange sets a handler called on the dispatch worker when the
+	// SSRC of the stream changes
+	OnSSRCChange(handler func(prev, ssrc uint32))
+
+	// WallClock maps a received RTP timestamp to the wall clock of the
+	// sender from its latest sender report, false until one is received
+	WallClock(timestamp uint32) (time.Time, bool)
+
+	// CNAME returns the canonical name of the source from its SDES, empty
+	// until one is received
+	CNAME() string
+
+	deliver(now time.Time) time.Duration
+	stats() (*receiverStats, *senderStats)
+	activity() time.Time
+	setSSRC(ssrc uint32)
+	setCNAME(cname string)
+	close()
 }
 
-func NewStream(ssrc uint32, timeout time.Duration, sendPacket func(*Packet) error) Stream {
-	return &stream{
+// FrameMode selects how received packets are assembled into frames
+type FrameMode int
+
+const (
+	// FrameMarker groups the packets of a timestamp into a frame completed
+	// by the marker bit and a contiguous sequence
+	FrameMarker FrameMode = iota
+
+	// FramePacket delivers every packet as a complete frame in arrival
+	// order, such as for audio
+	FramePacket
+
+	// FrameNone assembles no frames, packets are read by ReadPacket in
+	// arrival order or, with WithReorderWindow, in sequence order
+	FrameNone
+)
+
+func NewStream(ssrc uint32, timeout time.Duration, sendPacket func(*Packet) error, opts ...StreamOption) Stream {
+	s := &stream{
 		frameQueue: NewFrameWaitQueue(),
 		frameMap:   make(map[uint32]*Frame),
 		timeout:    timeout,
 		sendPacket: sendPacket,
 		ssrc:       ssrc,
 		sequencer:  NewRandomSequencer(),
+		closed:     make(chan struct{}),
+		created:    time.Now(),
+		mtu:        MTU,
+		readDepth:  defaultQueueDepth,
+		log:        nopLogger{},
+		metrics:    nopMetrics{},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	switch s.frameMode {
+	case FramePacket:
+		s.packetFrames = make(chan *Frame, s.readDepth)
+	case FrameNone:
+		s.packets = make(chan *Packet, s.readDepth)
+	}
+	return s
+}
+
+// ErrFrameTimeout is returned by ReadFrame with a frame still incomplete
+// after the read timeout
+var ErrFrameTimeout = errors.New("read frame timeout")
+
+var errLateFrame = errors.New("frame late for playout")
+
+// IncompletePolicy selects what ReadFrame does with a frame still incomplete
+// after the read timeout
+type IncompletePolicy int
+
+const (
+	// IncompleteWait returns the frame with ErrFrameTimeout
+	IncompleteWait IncompletePolicy = iota
+
+	// IncompletePartial returns the frame without error, see Frame.Missing
+	IncompletePartial
+
+	// IncompleteSkip drops the frame and reads the next complete one
+	IncompleteSkip
+
+	// IncompleteSkipToKey drops frames up to the next complete key frame,
+	// key frames are told by WithKeyFrame of the Conn
+	IncompleteSkipToKey
+)
+
+// rawPacket is a packet held by the reorder window
+type rawPacket struct {
+	p       *Packet
+	arrival time.Time
+}
+
+// streamHandlers are the callbacks of a stream, guarded by its mutex
+type streamHandlers struct {
+	frame   func(f *Frame)
+	packet  func(p *Packet)
+	timeout func(f *Frame)
+	ssrc    func(prev, ssrc uint32)
+}
+
+// DenyError reports a packet refused by its frame
+type DenyError struct {
+	Reason int
+}
+
+func (e *DenyError) Error() string {
+	return fmt.Sprintf("frame push failed: %v", e.Reason)
 }
 
 type stream struct {
@@ -45,6 +171,7 @@ type stream struct {
 
 	timeout time.Duration
 
+	// currFrame is the frame last read, guarded by the mutex
 	currFrame *Frame
 
 	sendPacket func(*Packet) error
@@ -53,21 +180,211 @@ type stream struct {
 
 	timestamp uint32
 
+	// timestamp and payload type of the last frame written
+	lastTimestamp uint32
+	lastType      byte
+
 	ssrc uint32
+
+	recv receiverStats
+
+	send senderStats
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	created   time.Time
+
+	mtu int
+
+	frameMode FrameMode
+
+	// readDepth is the capacity of packetFrames or packets
+	readDepth    int
+	packetFrames chan *Frame
+	lastPacket   *Frame
+
+	// packets and the reorder window of FrameNone
+	packets chan *Packet
+	window  int
+	reorder []rawPacket
+	nextSeq uint16
+	started bool
+
+	// rewriting of WritePacket, tsOffset is set by the first packet
+	rewriteSeq bool
+	rewriteTS  bool
+	tsOffset   uint32
+	offsetSet  bool
+
+	log Logger
+
+	metrics Metrics
+
+	// jitter schedules frame playout, nil releases frames once complete
+	jitter *jitterBuffer
+
+	incomplete IncompletePolicy
+	keyFrame   func(p *Packet) bool
+
+	// awaitKey drops frames up to a key frame after an incomplete one,
+	// guarded by the mutex
+	awaitKey bool
+
+	handlers streamHandlers
+
+	// SSRC changes not yet passed to the OnSSRCChange handler, guarded by
+	// the mutex
+	ssrcChanges [][2]uint32
+
+	// cname of the source, guarded by the mutex
+	cname string
+
+	// limits of the queued frames, 0 is unlimited
+	maxFrames int
+	maxBytes  int
+	maxAge    time.Duration
+	evicted   func(f *Frame, reason string)
 }
 
 func (s *stream) SSRC() uint32 {
-	return s.ssrc
+	return atomic.LoadUint32(&s.ssrc)
+}
+
+func (s *stream) WallClock(timestamp uint32) (time.Time, bool) {
+	return s.recv.wallClock(timestamp)
+}
+
+func (s *stream) CNAME() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cname
+}
+
+func (s *stream) setCNAME(cname string) {
+	s.mutex.Lock()
+	s.cname = cname
+	s.mutex.Unlock()
+}
+
+// setSSRC changes the SSRC of the stream, such as after a collision. The
+// OnSSRCChange handler is called by the next deliver.
+func (s *stream) setSSRC(ssrc uint32) {
+	prev := atomic.SwapUint32(&s.ssrc, ssrc)
+	s.mutex.Lock()
+	s.ssrcChanges = append(s.ssrcChanges, [2]uint32{prev, ssrc})
+	s.mutex.Unlock()
+}
+
+// notifySSRC passes the pending SSRC changes to the OnSSRCChange handler
+func (s *stream) notifySSRC() {
+	s.mutex.Lock()
+	changes := s.ssrcChanges
+	s.ssrcChanges = nil
+	h := s.handlers.ssrc
+	s.mutex.Unlock()
+
+	if h == nil {
+		return
+	}
+	for _, c := range changes {
+		h(c[0], c[1])
+	}
+}
+
+func (s *stream) stats() (*receiverStats, *senderStats) {
+	return &s.recv, &s.send
+}
+
+// activity returns the time of the last packet received or sent, or else
+// of the creation
+func (s *stream) activity() time.Time {
+	last := s.created
+	if t := s.recv.last(); t.After(last) {
+		last = t
+	}
+	if t := s.send.last(); t.After(last) {
+		last = t
+	}
+	return last
+}
+
+// close makes blocked and later ReadFrame calls return ErrClosed
+func (s *stream) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.frameQueue.Close()
+	})
+}
+
+// PlayoutDelay returns the current target delay of the jitter buffer
+func (s *stream) PlayoutDelay() time.Duration {
+	if s.jitter == nil {
+		return 0
+	}
+	return s.jitter.current()
+}
+
+func (s *stream) clockRate() uint32 {
+	if s.recv.clockRate == 0 {
+		return defaultClockRate
+	}
+	return s.recv.clockRate
+}
+
+// forget removes f from the frames receiving packets
+func (s *stream) forget(f *Frame) {
+	s.mutex.Lock()
+	delete(s.frameMap, f.Timestamp())
+	s.mutex.Unlock()
+}
+
+// waitPlayout waits for the playout time of f, errLateFrame means it has
+// passed already
+func (s *stream) waitPlayout(ctx context.Context, f *Frame) error {
+	jitter, _, _ := s.recv.quality()
+	wait := time.Until(s.jitter.schedule(f.Timestamp(), f.arrival, jitter, s.clockRate()))
+	if wait < 0 {
+		return errLateFrame
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closed:
+		return ErrClosed
+	case <-timer.C:
+		return nil
+	}
 }
 
 func (s *stream) dispatch(p *Packet) error {
-	if p.SSRC != s.ssrc {
+	if p.SSRC != s.SSRC() {
 		return errors.New("packet not SSRC stream")
 	}
+	now := time.Now()
+	s.recv.update(p, now)
+	if h := s.callbacks().packet; h != nil {
+		h(p)
+	}
+
+	if s.frameMode == FrameNone {
+		return s.dispatchRaw(p, now)
+	}
+
 	timestamp := p.Timestamp
+	if len(p.Payload) == 0 && p.PaddingSize > 0 {
+		s.dispatchPadding(p)
+		return nil
+	}
+
+	if s.frameMode == FramePacket {
+		return s.dispatchPacket(p)
+	}
 
 	var f *Frame
-	curr := s.currFrame
+	curr := s.current()
 	if curr != nil {
 		if timestamp < curr.Timestamp() {
 			return errors.New("packet too old")
@@ -81,6 +398,10 @@ func (s *stream) dispatch(p *Packet) error {
 		f = s.frameMap[timestamp]
 		if f == nil {
 			f = NewFrame(nil)
+			f.timestamp = timestamp
+			f.arrival = now
+			f.clockRate = s.clockRate()
+			f.clock = &s.recv
 		}
 		s.frameMap[timestamp] = f
 		s.mutex.Unlock()
@@ -88,83 +409,519 @@ func (s *stream) dispatch(p *Packet) error {
 
 		// heading
 		if f.prevFrame == nil && curr != nil {
-			f.prevFrame = curr
+			link(curr, f)
 		}
 	}
 
 	if ok := f.Push(p); ok != AcceptOk {
-		return fmt.Errorf("frame push failed: %v", ok)
+		return &DenyError{Reason: ok}
+	}
+	if f.isFull() {
+		s.recheck()
+	}
+
+	if s.maxFrames > 0 || s.maxBytes > 0 || s.maxAge > 0 {
+		s.evict(now)
+	}
+	return nil
+}
+
+// evict drops the stale queued frames, then the oldest ones preferring non
+// key frames until the queue is within its limits
+func (s *stream) evict(now time.Time) {
+	for {
+		var (
+			stale, oldest, victim *Frame
+			count, size           int
+		)
+		s.frameQueue.walk(func(f *Frame) {
+			if s.maxAge > 0 && now.Sub(f.arrival) > s.maxAge {
+				if stale == nil {
+					stale = f
+				}
+				return
+			}
+			if oldest == nil {
+				oldest = f
+			}
+			if victim == nil && !s.isKeyFrame(f) {
+				victim = f
+			}
+			count += 1
+			size += f.Len()
+		})
+
+		if stale != nil {
+			s.dropQueued(stale, "stale")
+			continue
+		}
+		if count == 0 || !((s.maxFrames > 0 && count > s.maxFrames) || (s.maxBytes > 0 && size > s.maxBytes)) {
+			return
+		}
+		if victim == nil {
+			victim = oldest
+		}
+		s.dropQueued(victim, "evicted")
+	}
+}
+
+// dropQueued releases a frame still queued
+func (s *stream) dropQueued(f *Frame, reason string) {
+	if !s.frameQueue.remove(f) {
+		return
+	}
+	s.forget(f)
+	f.unlink()
+	if s.evicted != nil {
+		s.evicted(f, reason)
+	}
+	f.Release()
+	s.metrics.FrameDropped(s.SSRC(), reason)
+	s.log.Debug("frame dropped", "ssrc", s.SSRC(), "timestamp", f.Timestamp(), "reason", reason)
+}
+
+// dispatchPacket queues p as a frame of its own
+func (s *stream) dispatchPacket(p *Packet) error {
+	f := NewFrame(nil)
+	f.clockRate = s.clockRate()
+	f.clock = &s.recv
+	f.Push(p)
+	f.mutex.Lock()
+	f.complete()
+	f.mutex.Unlock()
+
+	// only the timestamp, a chain of frames would keep every frame alive
+	if prev := s.lastPacket; prev != nil {
+		prev.mutex.Lock()
+		prev.nextTS, prev.hasNext = p.Timestamp, true
+		prev.mutex.Unlock()
+	}
+	s.lastPacket = f
+
+	if h := s.callbacks().frame; h != nil {
+		s.metrics.FrameCompleted(s.SSRC())
+		h(f)
+		return nil
+	}
+
+	select {
+	case s.packetFrames <- f:
+	default:
+		// the frame owns p, dropping it releases p
+		f.Release()
+		s.metrics.PacketDropped(s.SSRC(), "read")
+		s.log.Debug("packet dropped", "ssrc", s.SSRC(), "seq", p.Seq, "queue", "read")
 	}
 	return nil
 }
 
+// dispatchRaw queues p for ReadPacket, through the reorder window if any
+func (s *stream) dispatchRaw(p *Packet, now time.Time) error {
+	if s.window <= 0 {
+		s.emit(p)
+		return nil
+	}
+
+	if s.started && int16(p.Seq-s.nextSeq) < 0 {
+		return errors.New("packet too old")
+	}
+
+	i := len(s.reorder)
+	for i > 0 && int16(p.Seq-s.reorder[i-1].p.Seq) <= 0 {
+		if p.Seq == s.reorder[i-1].p.Seq {
+			return &DenyError{Reason: DenyPacketDuplicated}
+		}
+		i -= 1
+	}
+	s.reorder = append(s.reorder, rawPacket{})
+	copy(s.reorder[i+1:], s.reorder[i:])
+	s.reorder[i] = rawPacket{p: p, arrival: now}
+
+	s.flush(now)
+	return nil
+}
+
+// flush queues the packets of the reorder window in sequence, skipping a
+// gap once the window is full or its oldest packet waited the read timeout.
+// It returns the time until that timeout, 0 if none.
+func (s *stream) flush(now time.Time) time.Duration {
+	for len(s.reorder) > 0 {
+		head := s.reorder[0]
+		if !(s.started && head.p.Seq == s.nextSeq) && len(s.reorder) <= s.window {
+			if wait := head.arrival.Add(s.timeout).Sub(now); wait > 0 {
+				return wait
+			}
+		}
+
+		s.reorder[0] = rawPacket{}
+		s.reorder = s.reorder[1:]
+		s.nextSeq = head.p.Seq + 1
+		s.started = true
+		s.emit(head.p)
+	}
+	return 0
+}
+
+// emit queues p for ReadPacket, dropping it if the queue is full
+func (s *stream) emit(p *Packet) {
+	select {
+	case s.packets <- p:
+	default:
+		p.Release()
+		s.metrics.PacketDropped(s.SSRC(), "read")
+		s.log.Debug("packet dropped", "ssrc", s.SSRC(), "seq", p.Seq, "queue", "read")
+	}
+}
+
+func (s *stream) ReadPacket(ctx context.Context) (*Packet, error) {
+	if s.frameMode != FrameNone {
+		return nil, errors.New("stream assembles frames")
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, ErrClosed
+	case p := <-s.packets:
+		return p, nil
+	}
+}
+
+// dispatchPadding drops a padding-only packet, its sequence number is
+// accounted to the frame it follows.
+func (s *stream) dispatchPadding(p *Packet) {
+	defer p.Release()
+
+	f := s.current()
+	if f == nil || f.Timestamp() != p.Timestamp {
+		s.mutex.Lock()
+		f = s.frameMap[p.Timestamp]
+		s.mutex.Unlock()
+	}
+
+	if f != nil {
+		f.pad(p.Seq)
+		s.recheck()
+	}
+}
+
+// recheck completes the queued frames waiting for the frames before them,
+// in order so that each completion carries over to the next frame
+func (s *stream) recheck() {
+	s.frameQueue.walk(func(f *Frame) {
+		f.recheck()
+	})
+}
+
 func (s *stream) ReadFrame(ctx context.Context) (*Frame, error) {
-	f, err := s.frameQueue.Pop(ctx)
-	if err != nil {
-		return nil, err
+	if s.frameMode == FramePacket {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.closed:
+			return nil, ErrClosed
+		case f := <-s.packetFrames:
+			s.metrics.FrameCompleted(s.SSRC())
+			return f, nil
+		}
 	}
 
-	if f == nil {
-		return nil, errors.New("no packets")
+	for {
+		f, err := s.frameQueue.Pop(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if f == nil {
+			return nil, errors.New("no packets")
+		}
+
+		if s.jitter != nil {
+			if err := s.waitPlayout(ctx, f); err == errLateFrame {
+				s.skip(f, "late")
+				continue
+			} else if err != nil {
+				s.forget(f)
+				return f, err
+			}
+		}
+
+		// with a jitter buffer the frame is settled at its playout time
+		s.advance(f)
+		if s.jitter == nil {
+			select {
+			case <-ctx.Done():
+				s.forget(f)
+				return f, ctx.Err()
+			case <-s.closed:
+				s.forget(f)
+				return f, ErrClosed
+			case <-time.After(s.timeout):
+			case <-f.Done():
+			}
+		}
+
+		if ok, err := s.settle(f); ok {
+			return f, err
+		}
 	}
+}
 
-	defer func() {
+// settle applies the incomplete policy to a popped frame once complete or
+// timed out, ok is false if it was skipped. err is ErrFrameTimeout for an
+// incomplete frame delivered with IncompleteWait.
+func (s *stream) settle(f *Frame) (ok bool, err error) {
+	if f.IsComplete() {
+		key := s.isKeyFrame(f)
 		s.mutex.Lock()
-		delete(s.frameMap, f.Timestamp())
+		awaiting := s.awaitKey && !key
+		if !awaiting {
+			s.awaitKey = false
+		}
 		s.mutex.Unlock()
-	}()
 
+		if awaiting {
+			s.skip(f, "awaiting_key")
+			return false, nil
+		}
+		s.forget(f)
+		s.metrics.FrameCompleted(s.SSRC())
+		return true, nil
+	}
+
+	s.metrics.FrameTimedOut(s.SSRC())
+	s.log.Debug("frame timeout", "ssrc", s.SSRC(), "timestamp", f.Timestamp())
+
+	switch s.incomplete {
+	case IncompleteSkip:
+		s.skip(f, "incomplete")
+		return false, nil
+	case IncompleteSkipToKey:
+		s.mutex.Lock()
+		s.awaitKey = s.keyFrame != nil
+		s.mutex.Unlock()
+		s.skip(f, "incomplete")
+		return false, nil
+	}
+
+	s.forget(f)
+	if s.incomplete == IncompletePartial {
+		return true, nil
+	}
+	return true, ErrFrameTimeout
+}
+
+// deliver passes the SSRC changes and the frames ready to the OnSSRCChange,
+// OnFrame and OnTimeout handlers, it returns the time until the oldest frame
+// times out, 0 if none
+func (s *stream) deliver(now time.Time) time.Duration {
+	s.notifySSRC()
+
+	if s.frameMode == FrameNone {
+		return s.flush(now)
+	}
+
+	h := s.callbacks()
+	if h.frame == nil || s.frameMode == FramePacket {
+		return 0
+	}
+
+	for {
+		f := s.frameQueue.peek()
+		if f == nil {
+			return 0
+		}
+		if !f.IsComplete() {
+			if wait := f.arrival.Add(s.timeout).Sub(now); wait > 0 {
+				return wait
+			}
+		}
+		if !s.frameQueue.remove(f) {
+			return 0
+		}
+
+		s.advance(f)
+		ok, err := s.settle(f)
+		switch {
+		case !ok:
+		case err == nil:
+			h.frame(f)
+		case h.timeout != nil:
+			h.timeout(f)
+		default:
+			f.Release()
+		}
+	}
+}
+
+func (s *stream) callbacks() streamHandlers {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.handlers
+}
+
+func (s *stream) OnFrame(handler func(f *Frame)) {
+	s.mutex.Lock()
+	s.handlers.frame = handler
+	s.mutex.Unlock()
+}
+
+func (s *stream) OnPacket(handler func(p *Packet)) {
+	s.mutex.Lock()
+	s.handlers.packet = handler
+	s.mutex.Unlock()
+}
+
+func (s *stream) OnTimeout(handler func(f *Frame)) {
+	s.mutex.Lock()
+	s.handlers.timeout = handler
+	s.mutex.Unlock()
+}
+
+func (s *stream) OnSSRCChange(handler func(prev, ssrc uint32)) {
+	s.mutex.Lock()
+	s.handlers.ssrc = handler
+	s.mutex.Unlock()
+}
+
+func (s *stream) current() *Frame {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.currFrame
+}
+
+// advance makes f the current frame, the previous one receives no more
+// packets and forgets the frames before it
+func (s *stream) advance(f *Frame) {
+	s.mutex.Lock()
+	prev := s.currFrame
 	s.currFrame = f
-	select {
-	case <-ctx.Done():
-		return f, ctx.Err()
-	case <-time.After(s.timeout):
-		return f, errors.New("read frame timeout")
-	case <-f.Done():
-		return f, nil
+	s.mutex.Unlock()
+
+	if prev != nil && prev != f {
+		prev.unlink()
 	}
 }
 
+// skip releases a frame popped but not returned by ReadFrame
+func (s *stream) skip(f *Frame, reason string) {
+	s.advance(f)
+	s.forget(f)
+	f.Release()
+	s.metrics.FrameDropped(s.SSRC(), reason)
+	s.log.Debug("frame dropped", "ssrc", s.SSRC(), "timestamp", f.Timestamp(), "reason", reason)
+}
+
+func (s *stream) isKeyFrame(f *Frame) bool {
+	if s.keyFrame == nil {
+		return true
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.First() != nil && s.keyFrame(f.First())
+}
+
 func (s *stream) WriteFrame(payload []byte, typ byte, samples uint32, csrc []uint32) (int, error) {
+	return s.WriteFrameContext(context.Background(), payload, typ, samples, csrc)
+}
+
+// WriteFrameContext is WriteFrame giving up when ctx is done while waiting
+// for room in the write queue, the frame is then partially sent.
+func (s *stream) WriteFrameContext(ctx context.Context, payload []byte, typ byte, samples uint32, csrc []uint32) (int, error) {
 	var (
-		start, end int
-		sent       int
-		err        error
+		sent int
+		err  error
 	)
 
+	s.lastTimestamp = s.timestamp
+	s.lastType = typ
 	defer func() {
 		s.timestamp += samples
 	}()
 
-	for left := len(payload); left > 0; left = len(payload) {
-		p := &Packet{
-			PT:        typ,
-			Seq:       s.sequencer.Next(),
-			Timestamp: s.timestamp,
-			SSRC:      s.ssrc,
-			CSRC:      csrc,
+	for len(payload) > 0 {
+		if err = ctx.Err(); err != nil {
+			break
 		}
 
-		if left > MTU {
-			end = start + MTU
+		b := newPacketBuffer()
+		p := &b.packet
+		p.ctx = ctx
+		p.PT = typ
+		p.Seq = s.sequencer.Next()
+		p.Timestamp = s.timestamp
+		p.SSRC = s.SSRC()
+		p.CSRC = append(b.csrc[:0], csrc...)
+
+		size := len(payload)
+		if size > s.mtu {
+			size = s.mtu
 		} else {
-			end = start + left
 			p.Marker = 1
 		}
 
-		p.Payload = payload[start:end]
-		start = end
-		payload = payload[end:]
+		p.Payload = payload[:size]
+		payload = payload[size:]
 
+		// the packet belongs to the sender from here on
+		timestamp := p.Timestamp
 		err = s.sendPacket(p)
 		if err != nil {
 			break
 		}
-		sent += len(p.Payload)
+		s.send.update(timestamp, size, time.Now())
+		sent += size
 	}
 	return sent, err
 }
 
+func (s *stream) WritePacket(p *Packet) error {
+	p.SSRC = s.SSRC()
+	if s.rewriteSeq {
+		p.Seq = s.sequencer.Next()
+	}
+	if s.rewriteTS {
+		if !s.offsetSet {
+			s.tsOffset = s.timestamp - p.Timestamp
+			s.offsetSet = true
+		}
+		p.Timestamp += s.tsOffset
+	}
+	s.lastTimestamp = p.Timestamp
+	s.lastType = p.PT
+
+	timestamp, size := p.Timestamp, len(p.Payload)
+	if err := s.sendPacket(p); err != nil {
+		return err
+	}
+	s.send.update(timestamp, size, time.Now())
+	return nil
+}
+
+// WritePadding sends a packet of size padding octets and no payload, such
+// as a bandwidth probe. It repeats the timestamp of the last frame and takes
+// the next sequence number. size ranges from 1 to 255.
+func (s *stream) WritePadding(size int) error {
+	if size < 1 || size > 255 {
+		return errors.New("padding size out of range")
+	}
+
+	b := newPacketBuffer()
+	p := &b.packet
+	p.PT = s.lastType
+	p.Seq = s.sequencer.Next()
+	p.Timestamp = s.lastTimestamp
+	p.SSRC = s.SSRC()
+	p.PaddingSize = byte(size)
+
+	if err := s.sendPacket(p); err != nil {
+		return err
+	}
+	s.send.padding()
+	return nil
+}
+
 func (s *stream) SkipSamples(samples uint32) {
 	s.timestamp += samples
 }
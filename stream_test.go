@@ -0,0 +1,124 @@
+package rtp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPacket(t *testing.T) {
+	ctx := context.Background()
+	read := func(s Stream) []uint16 {
+		var seqs []uint16
+		for {
+			select {
+			case p := <-s.(*stream).packets:
+				seqs = append(seqs, p.Seq)
+			default:
+				return seqs
+			}
+		}
+	}
+
+	s := NewStream(1234, 50*time.Millisecond, nil, WithFrameMode(FrameNone))
+	for _, seq := range []uint16{3, 1, 2} {
+		assert.Nil(t, s.dispatch(&Packet{Seq: seq, SSRC: 1234}))
+	}
+	p, err := s.ReadPacket(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(3), p.Seq)
+	assert.Equal(t, []uint16{1, 2}, read(s))
+
+	s = NewStream(1234, 50*time.Millisecond, nil, WithFrameMode(FrameNone), WithReorderWindow(3))
+	for _, seq := range []uint16{10, 12, 11} {
+		assert.Nil(t, s.dispatch(&Packet{Seq: seq, SSRC: 1234}))
+	}
+	assert.Nil(t, read(s))
+
+	// a full window releases the packets in sequence
+	assert.Nil(t, s.dispatch(&Packet{Seq: 13, SSRC: 1234}))
+	assert.Equal(t, []uint16{10, 11, 12, 13}, read(s))
+
+	// a gap is skipped after the read timeout
+	assert.Nil(t, s.dispatch(&Packet{Seq: 15, SSRC: 1234}))
+	assert.Nil(t, read(s))
+	assert.Equal(t, time.Duration(0), s.deliver(time.Now().Add(60*time.Millisecond)))
+	assert.Equal(t, []uint16{15}, read(s))
+	assert.NotNil(t, s.dispatch(&Packet{Seq: 14, SSRC: 1234}))
+}
+
+func TestWritePacket(t *testing.T) {
+	var sent []*Packet
+	s := NewStream(1234, time.Second, func(p *Packet) error {
+		sent = append(sent, p)
+		return nil
+	}, WithRewrite(true, true), WithInitialSequence(100), WithInitialTimestamp(5000))
+
+	assert.Nil(t, s.WritePacket(&Packet{Seq: 7, Timestamp: 90000, SSRC: 9, Payload: []byte{1}}))
+	assert.Nil(t, s.WritePacket(&Packet{Seq: 8, Timestamp: 93000, SSRC: 9, Payload: []byte{2}}))
+	assert.Equal(t, 2, len(sent))
+	for i, p := range sent {
+		assert.Equal(t, uint32(1234), p.SSRC)
+		assert.Equal(t, uint16(100+i), p.Seq)
+		assert.Equal(t, uint32(5000+i*3000), p.Timestamp)
+		assert.Equal(t, []byte{byte(i + 1)}, p.Payload)
+	}
+}
+
+func TestPacketFramesFull(t *testing.T) {
+	dc := newDatagramConn()
+	m := &countMetrics{}
+	c := NewConn(dc, time.Second,
+		WithMetrics(m),
+		WithDispatchPolicy(QueueBlock),
+		WithStreamOptions(WithFrameMode(FramePacket)))
+	defer c.Close()
+	s := c.Stream(1234)
+
+	// nobody reads, the frames past the queue are dropped
+	for i := 0; i < 300; i++ {
+		dc.readCh <- (&Packet{Seq: uint16(i), Timestamp: uint32(i) * 160, SSRC: 1234, Payload: []byte{1}}).Encode()
+	}
+	assert.Eventually(t, func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		return m.packetsDropped["read"] == 200
+	}, time.Second, 10*time.Millisecond)
+
+	f, err := s.ReadFrame(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0), f.First().Seq)
+	f.Release()
+}
+
+func TestReadFrameConcurrent(t *testing.T) {
+	s := NewStream(1234, 20*time.Millisecond, nil, WithIncompletePolicy(IncompleteSkipToKey))
+	go func() {
+		for i := 0; i < 200; i++ {
+			s.dispatch(&Packet{Seq: uint16(2 * i), Timestamp: uint32(i) * 300, SSRC: 1234, Marker: 1, Payload: []byte{1}})
+			s.dispatch(&Packet{Seq: uint16(2*i + 1), Timestamp: uint32(i) * 300, SSRC: 1234, PaddingSize: 1})
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 200; i++ {
+		f, err := s.ReadFrame(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(i)*300, f.Timestamp())
+		f.Release()
+	}
+}
+
+func TestFirstFrameComplete(t *testing.T) {
+	s := NewStream(1234, time.Minute, nil)
+	s.dispatch(&Packet{Seq: 1, Timestamp: 3000, SSRC: 1234, Marker: 1, Payload: []byte{1}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	f, err := s.ReadFrame(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3000), f.Timestamp())
+}
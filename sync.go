@@ -0,0 +1,79 @@
+package rtp
+
+import (
+	"sync"
+	"time"
+)
+
+// Synchronizer groups received streams by the CNAME of their sender and
+// aligns their playout, such as the audio and video of a source for
+// lip-sync.
+type Synchronizer struct {
+	mutex   sync.Mutex
+	streams []Stream
+}
+
+func NewSynchronizer() *Synchronizer {
+	return &Synchronizer{}
+}
+
+// Add adds s to the synchronized streams
+func (sy *Synchronizer) Add(s Stream) {
+	sy.mutex.Lock()
+	defer sy.mutex.Unlock()
+
+	for _, o := range sy.streams {
+		if o == s {
+			return
+		}
+	}
+	sy.streams = append(sy.streams, s)
+}
+
+// Remove removes s from the synchronized streams
+func (sy *Synchronizer) Remove(s Stream) {
+	sy.mutex.Lock()
+	defer sy.mutex.Unlock()
+
+	for i, o := range sy.streams {
+		if o == s {
+			sy.streams = append(sy.streams[:i], sy.streams[i+1:]...)
+			return
+		}
+	}
+}
+
+// Groups returns the streams by CNAME, streams without a CNAME yet are left
+// out
+func (sy *Synchronizer) Groups() map[string][]Stream {
+	sy.mutex.Lock()
+	defer sy.mutex.Unlock()
+
+	groups := map[string][]Stream{}
+	for _, s := range sy.streams {
+		if cname := s.CNAME(); cname != "" {
+			groups[cname] = append(groups[cname], s)
+		}
+	}
+	return groups
+}
+
+// Offset returns the delay to add to the playout of a for its frames to
+// play out in sync with those of b, negative when b is to be delayed
+// instead. It compares the time from capture to playout of the last
+// packets, WithJitterBuffer included. ok is false until both streams share
+// a CNAME and received a sender report.
+func (sy *Synchronizer) Offset(a, b Stream) (offset time.Duration, ok bool) {
+	if a.CNAME() == "" || a.CNAME() != b.CNAME() {
+		return 0, false
+	}
+
+	recvA, _ := a.stats()
+	recvB, _ := b.stats()
+	delayA, okA := recvA.delay()
+	delayB, okB := recvB.delay()
+	if !okA || !okB {
+		return 0, false
+	}
+	return delayB + b.PlayoutDelay() - delayA - a.PlayoutDelay(), true
+}
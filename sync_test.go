@@ -0,0 +1,55 @@
+package rtp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSynchronizer(t *testing.T) {
+	audio := NewStream(1111, 10*time.Millisecond, nil, WithClockRate(48000))
+	video := NewStream(2222, 10*time.Millisecond, nil)
+	other := NewStream(3333, 10*time.Millisecond, nil)
+	audio.setCNAME("user@host")
+	video.setCNAME("user@host")
+	other.setCNAME("other@host")
+
+	sy := NewSynchronizer()
+	for _, s := range []Stream{audio, video, other} {
+		sy.Add(s)
+	}
+	groups := sy.Groups()
+	assert.ElementsMatch(t, []Stream{audio, video}, groups["user@host"])
+	assert.Equal(t, []Stream{other}, groups["other@host"])
+
+	_, ok := sy.Offset(audio, video)
+	assert.False(t, ok)
+
+	// both sampled at base, audio is captured 100ms later and video 50ms
+	base := time.Now()
+	for _, s := range []Stream{audio, video} {
+		recv, _ := s.stats()
+		recv.onSenderReport(toNTPTime(base), 0, base)
+	}
+	assert.Nil(t, audio.dispatch(&Packet{Seq: 1, Timestamp: 4800, SSRC: 1111, Marker: 1, Payload: []byte{1}}))
+	assert.Nil(t, video.dispatch(&Packet{Seq: 1, Timestamp: 4500, SSRC: 2222, Marker: 1, Payload: []byte{1}}))
+
+	// video arrives 50ms longer after its capture than audio
+	offset, ok := sy.Offset(audio, video)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(50*time.Millisecond), float64(offset), float64(5*time.Millisecond))
+	_, ok = sy.Offset(audio, other)
+	assert.False(t, ok)
+
+	f, err := video.ReadFrame(context.Background())
+	assert.Nil(t, err)
+	capture, ok := f.CaptureTime()
+	assert.True(t, ok)
+	assert.InDelta(t, base.Add(50*time.Millisecond).UnixNano(), capture.UnixNano(), float64(time.Microsecond))
+
+	wall, ok := audio.WallClock(48000)
+	assert.True(t, ok)
+	assert.InDelta(t, base.Add(time.Second).UnixNano(), wall.UnixNano(), float64(time.Microsecond))
+}